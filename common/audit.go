@@ -0,0 +1,83 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AuditReport compares what the db says was produced with what is in the output.
+type AuditReport struct {
+	Checked    int      `json:"checked"`
+	Missing    []string `json:"missing"`
+	Mismatched []string `json:"mismatched"`
+	Extra      []string `json:"extra"`
+}
+
+func (x AuditReport) OK() bool {
+	return len(x.Missing) == 0 && len(x.Mismatched) == 0 && len(x.Extra) == 0
+}
+
+// Audit re-hashes every recorded original, skip names files photoz owns in the output (ie. the db)
+func Audit(ctx context.Context, db IFastCache, fs *FileSystem, outPath string, skip ...string) (AuditReport, error) {
+	report := AuditReport{Missing: []string{}, Mismatched: []string{}, Extra: []string{}}
+	expected := make(map[string]bool)
+	for _, file := range skip {
+		expected[filepath.Clean(file)] = true
+	}
+
+	db.ForEach(func(item ImageFileInfo) {
+		if ctx.Err() != nil {
+			return
+		}
+		outFile := filepath.Join(outPath, item.OutputPath())
+		expected[outFile] = true
+		expected[SidecarFile(outFile)] = true
+		if item.IsRAW() {
+			expected[PreviewFile(outFile)] = true
+		}
+		report.Checked += 1
+
+		if _, err := os.Stat(outFile); err != nil {
+			fs.logger().Error().Err(err).Str("photoz", "audit").Str("file", outFile).Msg("missing")
+			report.Missing = append(report.Missing, outFile)
+			return
+		}
+		// re-encoded copies can't match the source md5
+		if item.ConvertedTo != "" {
+			return
+		}
+		md5, err := fs.CalculateMD5(ctx, outFile)
+		if err != nil || md5 != item.MD5 {
+			fs.logger().Error().Err(err).Str("photoz", "audit").Str("file", outFile).Str("md5", item.MD5).Str("outMD5", md5).Msg("mismatch")
+			report.Mismatched = append(report.Mismatched, outFile)
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	err := filepath.Walk(outPath, func(filePath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || expected[filePath] {
+			return nil
+		}
+		// AAE edits and Live Photo movies copied with their photo share its output stem
+		if ext := filepath.Ext(filePath); strings.EqualFold(ext, ".aae") || strings.EqualFold(ext, ".mov") {
+			stem := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+			matches, _ := filepath.Glob(stem + ".*")
+			for _, match := range matches {
+				if expected[match] {
+					return nil
+				}
+			}
+		}
+		report.Extra = append(report.Extra, filePath)
+		return nil
+	})
+	return report, err
+}
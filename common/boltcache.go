@@ -0,0 +1,276 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("photoz")
+
+// md5s marked with Tombstone, kept out of boltBucket so nothing iterating entries sees them
+var tombstoneBucket = []byte("tombstones")
+
+// BoltCache keeps entries on disk so large libraries don't have to fit in memory.
+type BoltCache struct {
+	db    *bolt.DB
+	logTo Logger
+}
+
+func NewBoltCache(persistFile string) (*BoltCache, error) {
+	db, err := bolt.Open(persistFile, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	// Persist() does the fsync, not every Set()
+	db.NoSync = true
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(tombstoneBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltCache{db: db}, nil
+}
+
+func (x *BoltCache) Get(key string, obj ImageFileInfo) (interface{}, bool) {
+	var jsonData []byte
+	x.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltBucket).Get([]byte(key))
+		if value != nil {
+			jsonData = append(jsonData, value...)
+		}
+		return nil
+	})
+	if jsonData == nil {
+		return nil, false
+	}
+	if err := json.Unmarshal(jsonData, &obj); err != nil {
+		x.logger().Error().Err(err).Str("boltcache", "get").Msg("fromJson")
+		return nil, false
+	}
+	return obj, true
+}
+
+func (x *BoltCache) Set(key string, value interface{}, duration time.Duration) {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		x.logger().Error().Err(err).Str("boltcache", "set").Msg("toJson")
+		return
+	}
+	err = x.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), jsonData)
+	})
+	if err != nil {
+		x.logger().Error().Err(err).Str("boltcache", "set").Msg("put")
+	}
+}
+
+func (x *BoltCache) SetIfAbsent(key string, value ImageFileInfo) (ImageFileInfo, bool) {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		x.logger().Error().Err(err).Str("boltcache", "setifabsent").Msg("toJson")
+		return value, false
+	}
+	stored, isNew := value, true
+	err = x.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		if existing := bucket.Get([]byte(key)); existing != nil {
+			var obj ImageFileInfo
+			// unreadable entries are overwritten like a missing one
+			if json.Unmarshal(existing, &obj) == nil {
+				stored, isNew = obj, false
+				return nil
+			}
+		}
+		return bucket.Put([]byte(key), jsonData)
+	})
+	if err != nil {
+		x.logger().Error().Err(err).Str("boltcache", "setifabsent").Msg("put")
+	}
+	return stored, isNew
+}
+
+func (x *BoltCache) Delete(pattern string) {
+	x.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		keys := make([]string, 0)
+		bucket.ForEach(func(k, v []byte) error {
+			if strings.Contains(string(k), pattern) {
+				keys = append(keys, string(k))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := bucket.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (x *BoltCache) Remove(key string) {
+	x.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+}
+
+func (x *BoltCache) Clear() {
+	x.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(boltBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(boltBucket)
+		return err
+	})
+}
+
+func (x *BoltCache) Tombstone(md5 string) {
+	err := x.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tombstoneBucket).Put([]byte(md5), []byte(time.Now().UTC().Format(time.RFC3339)))
+	})
+	if err != nil {
+		x.logger().Error().Err(err).Str("boltcache", "tombstone").Msg("put")
+	}
+}
+
+func (x *BoltCache) IsTombstoned(md5 string) bool {
+	found := false
+	x.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(tombstoneBucket).Get([]byte(md5)) != nil
+		return nil
+	})
+	return found
+}
+
+func (x *BoltCache) Tombstones() []string {
+	out := make([]string, 0)
+	x.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tombstoneBucket).ForEach(func(k, v []byte) error {
+			out = append(out, string(k))
+			return nil
+		})
+	})
+	return out
+}
+
+func (x *BoltCache) Persist() error {
+	return x.db.Sync()
+}
+
+// Compact copies the live pages to a new file and swaps it in, bolt never shrinks a file on its own
+func (x *BoltCache) Compact() error {
+	path := x.db.Path()
+	tmpFile := path + ".tmp"
+	dst, err := bolt.Open(tmpFile, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	err = bolt.Compact(dst, x.db, 64*1024*1024)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := x.db.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		return err
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	db.NoSync = true
+	x.db = db
+	return nil
+}
+
+func (x *BoltCache) Close() error {
+	return x.db.Close()
+}
+
+func (x *BoltCache) List() []string {
+	out := make([]string, 0)
+	x.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			out = append(out, string(v))
+			return nil
+		})
+	})
+	return out
+}
+
+func (x *BoltCache) Keys() []string {
+	out := make([]string, 0)
+	x.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			out = append(out, string(k))
+			return nil
+		})
+	})
+	return out
+}
+
+func (x *BoltCache) ForEach(fn func(ImageFileInfo)) {
+	x.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			obj := ImageFileInfo{}
+			if err := json.Unmarshal(v, &obj); err != nil {
+				x.logger().Error().Err(err).Str("boltcache", "foreach").Str("key", string(k)).Msg("fromJson")
+				return nil
+			}
+			fn(obj)
+			return nil
+		})
+	})
+}
+
+func (x *BoltCache) Stats() DBStats {
+	return tallyStats(x)
+}
+
+func (x *BoltCache) ToJSON(fileName string) error {
+	json, _ := json.MarshalIndent(x.List(), "", "    ")
+	return os.WriteFile(fileName, []byte(json), 0644)
+}
+
+func (x *BoltCache) ToJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	err := x.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			if _, err := bw.Write(v); err != nil {
+				return err
+			}
+			return bw.WriteByte('\n')
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// SetLogger sends the cache's log lines to logger instead of the global sloan log
+func (x *BoltCache) SetLogger(logger Logger) {
+	x.logTo = logger
+}
+
+func (x *BoltCache) logger() Logger {
+	return loggerOr(x.logTo)
+}
@@ -0,0 +1,67 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// CompactReport is what -compact dropped from the db and path index
+type CompactReport struct {
+	Checked int `json:"checked"`
+	// source paths of dropped entries, gone from the source and never copied
+	Dropped []string `json:"dropped"`
+	// path index entries for files that no longer exist
+	PathsDropped int `json:"pathsdropped"`
+}
+
+// Compact drops entries whose source is gone unless their copy is in the output, then rewrites
+// the db and path index. paths may be nil when there is no path index.
+func Compact(db, paths IFastCache, outPath string, logger Logger) (CompactReport, error) {
+	logger = loggerOr(logger)
+	report := CompactReport{Dropped: []string{}}
+	// keys first, a bolt db can't be written to from inside ForEach
+	for _, key := range db.Keys() {
+		obj, found := db.Get(key, ImageFileInfo{})
+		if !found {
+			continue
+		}
+		item := obj.(ImageFileInfo)
+		report.Checked += 1
+		if _, err := os.Stat(item.FilePath); err == nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(outPath, item.OutputPath())); err == nil {
+			continue
+		}
+		logger.Info().Str("photoz", "compact").Str("file", item.FilePath).Str("md5", item.MD5).Msg("stale entry dropped")
+		report.Dropped = append(report.Dropped, item.FilePath)
+		db.Remove(key)
+	}
+	if err := rewrite(db); err != nil {
+		return report, err
+	}
+
+	if paths == nil {
+		return report, nil
+	}
+	// only a cache of md5s, a missing file just gets hashed again if it comes back
+	for _, filePath := range paths.Keys() {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			paths.Remove(filePath)
+			report.PathsDropped += 1
+		}
+	}
+	return report, rewrite(paths)
+}
+
+// rewrite saves the db, a bolt file is also copied over so the freed pages go away
+func rewrite(db IFastCache) error {
+	if err := db.Persist(); err != nil {
+		return err
+	}
+	if compactor, ok := db.(interface{ Compact() error }); ok {
+		return compactor.Compact()
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// format names accepted by -convert and the mime types IsImage reports for them
+var convertFormats = map[string]string{
+	"heic": "image/heic",
+	"jpeg": "image/jpeg",
+	"jpg":  "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// what ConvertFile can write and the extension the output gets
+var convertTargets = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+}
+
+// ParseConvert reads rules like heic:jpeg into source mime type -> target format
+func ParseConvert(rules string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		from, to, found := strings.Cut(strings.ToLower(rule), ":")
+		if to == "jpg" {
+			to = "jpeg"
+		}
+		mime, known := convertFormats[from]
+		if _, target := convertTargets[to]; !found || !known || !target {
+			return nil, fmt.Errorf("invalid conversion %q", rule)
+		}
+		out[mime] = to
+	}
+	return out, nil
+}
+
+// ConvertExtension is the file extension for a conversion target
+func ConvertExtension(targetFormat string) string {
+	return convertTargets[targetFormat]
+}
+
+// orient turns img upright for an EXIF orientation, 2-8 are the mirror and rotate combinations
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	if orientation >= 5 {
+		out = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := x, y
+			switch orientation {
+			case 2:
+				dx = w - 1 - x
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dy = h - 1 - y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			out.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
+
+// external tools tried in order for formats the standard library can't decode (ie. HEIC)
+var converters = [][]string{
+	{"heif-convert", "-q", "92", "{src}", "{dst}"},
+	{"magick", "{src}", "{dst}"},
+	{"sips", "-s", "format", "{format}", "{src}", "--out", "{dst}"},
+}
+
+// ConvertFile re-encodes src as targetFormat (jpeg or png) at dst instead of a byte copy, an
+// EXIF orientation other than 0 or 1 is applied so the output is upright
+func (x *FileSystem) ConvertFile(src, dst, targetFormat string, orientation int) error {
+	if _, found := convertTargets[targetFormat]; !found {
+		return errors.New("unknown conversion target " + targetFormat)
+	}
+	err := x.convertImage(src, dst, targetFormat, orientation)
+	if errors.Is(err, image.ErrFormat) {
+		err = x.convertExternal(src, dst, targetFormat)
+	}
+	if err != nil {
+		os.Remove(dst)
+		x.logger().Error().Err(err).Str("component", "filesystem").Str("file", src).Str("format", targetFormat).Msg("convert")
+		return err
+	}
+	return x.Chmod(dst, x.FilePerm)
+}
+
+func (x *FileSystem) convertImage(src, dst, targetFormat string, orientation int) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	img, _, err := image.Decode(in)
+	if err != nil {
+		return err
+	}
+	img = orient(img, orientation)
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if targetFormat == "png" {
+		err = png.Encode(out, img)
+	} else {
+		err = jpeg.Encode(out, img, &jpeg.Options{Quality: 92})
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (x *FileSystem) convertExternal(src, dst, targetFormat string) error {
+	for _, converter := range converters {
+		if _, err := exec.LookPath(converter[0]); err != nil {
+			continue
+		}
+		args := make([]string, 0, len(converter)-1)
+		for _, arg := range converter[1:] {
+			arg = strings.NewReplacer("{src}", src, "{dst}", dst, "{format}", targetFormat).Replace(arg)
+			args = append(args, arg)
+		}
+		output, err := exec.Command(converter[0], args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %w: %s", converter[0], err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+	return errors.New("no converter found, install heif-convert or ImageMagick")
+}
@@ -0,0 +1,267 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counters track a scan while it runs and are safe to read from other goroutines.
+type Counters struct {
+	// where progress lines go, the processor hands over its own
+	logger     Logger
+	Files      atomic.Int64
+	Originals  atomic.Int64
+	Duplicates atomic.Int64
+	// bytes of every file walked
+	BytesScanned atomic.Int64
+	// duplicates of originals recorded in a -known-dbs database
+	KnownDuplicates atomic.Int64
+	// files whose md5 was tombstoned
+	Tombstoned atomic.Int64
+	// copies whose hash did not match the original
+	VerifyFailed atomic.Int64
+	// images outside -since/-until
+	DateFiltered atomic.Int64
+	// files outside -min-size/-max-size
+	SizeFiltered atomic.Int64
+	// audio and video left out without -include-audio/-include-video
+	MediaSkipped atomic.Int64
+	// scanned, not skipped and not matched by any signature
+	Unrecognized atomic.Int64
+	// zero byte files
+	Empty atomic.Int64
+	// -from-list paths that could not be read
+	ListErrors atomic.Int64
+	// images that failed -validate-decode
+	DecodeFailed atomic.Int64
+	// files that failed while reading their content
+	ReadErrors atomic.Int64
+	// originals that could not be written to the output
+	CopyErrors atomic.Int64
+	// duplicates -remove-duplicates could not delete
+	RemoveErrors atomic.Int64
+	// originals whose identical copy was already in the output
+	AlreadyPresent atomic.Int64
+	// originals whose EXIF failed to parse
+	ExifCorrupt atomic.Int64
+	// files counted by -count-first, zero when unknown
+	Total atomic.Int64
+	// unix nanos the rate is measured from, SetTotal restarts it while -http reads it
+	started atomic.Int64
+
+	mu                  sync.Mutex
+	unrecognizedSamples []string
+	emptyFiles          []string
+	unreadableFiles     []string
+	current             string
+}
+
+// Stats is a point in time copy of the Counters.
+type Stats struct {
+	Files               int64    `json:"files"`
+	Originals           int64    `json:"originals"`
+	Duplicates          int64    `json:"duplicates"`
+	BytesScanned        int64    `json:"bytesscanned"`
+	KnownDuplicates     int64    `json:"knownduplicates"`
+	Tombstoned          int64    `json:"tombstoned"`
+	VerifyFailed        int64    `json:"verifyfailed"`
+	DateFiltered        int64    `json:"datefiltered"`
+	SizeFiltered        int64    `json:"sizefiltered"`
+	MediaSkipped        int64    `json:"mediaskipped"`
+	Unrecognized        int64    `json:"unrecognized"`
+	UnrecognizedSamples []string `json:"unrecognizedsamples"`
+	Empty               int64    `json:"empty"`
+	EmptyFiles          []string `json:"emptyfiles,omitempty"`
+	ListErrors          int64    `json:"listerrors"`
+	DecodeFailed        int64    `json:"decodefailed"`
+	ReadErrors          int64    `json:"readerrors"`
+	UnreadableFiles     []string `json:"unreadablefiles,omitempty"`
+	CopyErrors          int64    `json:"copyerrors"`
+	RemoveErrors        int64    `json:"removeerrors"`
+	AlreadyPresent      int64    `json:"alreadypresent"`
+	ExifCorrupt         int64    `json:"exifcorrupt"`
+	// hard failures, see Failures
+	Errors int64 `json:"errors"`
+}
+
+// Failures sums the errors that mean photos were not archived or not removed as asked, corrupt EXIF and
+// failed decodes are reported but the photo was still copied
+func (x Stats) Failures() int64 {
+	return x.ReadErrors + x.CopyErrors + x.VerifyFailed + x.ListErrors + x.RemoveErrors
+}
+
+func (x *Counters) Snapshot() Stats {
+	stats := Stats{
+		Files:               x.Files.Load(),
+		Originals:           x.Originals.Load(),
+		Duplicates:          x.Duplicates.Load(),
+		BytesScanned:        x.BytesScanned.Load(),
+		KnownDuplicates:     x.KnownDuplicates.Load(),
+		Tombstoned:          x.Tombstoned.Load(),
+		VerifyFailed:        x.VerifyFailed.Load(),
+		DateFiltered:        x.DateFiltered.Load(),
+		SizeFiltered:        x.SizeFiltered.Load(),
+		MediaSkipped:        x.MediaSkipped.Load(),
+		Unrecognized:        x.Unrecognized.Load(),
+		UnrecognizedSamples: x.UnrecognizedSamples(),
+		Empty:               x.Empty.Load(),
+		EmptyFiles:          x.EmptyFiles(),
+		ListErrors:          x.ListErrors.Load(),
+		DecodeFailed:        x.DecodeFailed.Load(),
+		ReadErrors:          x.ReadErrors.Load(),
+		UnreadableFiles:     x.UnreadableFiles(),
+		CopyErrors:          x.CopyErrors.Load(),
+		RemoveErrors:        x.RemoveErrors.Load(),
+		AlreadyPresent:      x.AlreadyPresent.Load(),
+		ExifCorrupt:         x.ExifCorrupt.Load(),
+	}
+	stats.Errors = stats.Failures()
+	return stats
+}
+
+// how many example paths to keep for each reported bucket
+const maxSamples = 25
+
+func (x *Counters) AddUnrecognized(filePath string) {
+	x.Unrecognized.Add(1)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if len(x.unrecognizedSamples) < maxSamples {
+		x.unrecognizedSamples = append(x.unrecognizedSamples, filePath)
+	}
+}
+
+func (x *Counters) UnrecognizedSamples() []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return append([]string(nil), x.unrecognizedSamples...)
+}
+
+// SetCurrent records the file being worked on for the status endpoint
+func (x *Counters) SetCurrent(filePath string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.current = filePath
+}
+
+func (x *Counters) Current() string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.current
+}
+
+func NewCounters() *Counters {
+	counters := &Counters{}
+	counters.started.Store(time.Now().UnixNano())
+	return counters
+}
+
+func (x *Counters) Rate() float64 {
+	elapsed := time.Since(time.Unix(0, x.started.Load())).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(x.Files.Load()) / elapsed
+}
+
+// ReportProgress logs a throughput line every interval until stop is called.
+func (x *Counters) ReportProgress(interval time.Duration) (stop func()) {
+	return every(interval, x.logProgress)
+}
+
+// every runs fn on a ticker, stop waits for a run in flight to finish
+func every(interval time.Duration, fn func()) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-finished
+	}
+}
+
+// SetTotal records the pre-counted file total and restarts the rate clock so the count walk does not drag the rate down
+func (x *Counters) SetTotal(total int64) {
+	x.Total.Store(total)
+	x.started.Store(time.Now().UnixNano())
+}
+
+// Progress is where a scan stands, Total, Percent and ETA stay zero without a pre-count
+type Progress struct {
+	Files      int64
+	Total      int64
+	Originals  int64
+	Duplicates int64
+	Percent    float64
+	// files per second
+	Rate float64
+	ETA  time.Duration
+}
+
+func (x *Counters) Progress() Progress {
+	progress := Progress{Files: x.Files.Load(), Total: x.Total.Load(), Originals: x.Originals.Load(), Duplicates: x.Duplicates.Load(), Rate: x.Rate()}
+	if progress.Total <= 0 {
+		return progress
+	}
+	progress.Percent = min(100*float64(progress.Files)/float64(progress.Total), 100)
+	// files that appeared after the count can push the walk past the total
+	if remaining := progress.Total - progress.Files; remaining > 0 && progress.Rate > 0 {
+		progress.ETA = (time.Duration(float64(remaining)/progress.Rate) * time.Second).Round(time.Second)
+	}
+	return progress
+}
+
+// logProgress only logs, printing is up to the program embedding photoz
+func (x *Counters) logProgress() {
+	progress := x.Progress()
+	line := loggerOr(x.logger).Info().Int64("files", progress.Files).Int64("originals", progress.Originals).Int64("duplicates", progress.Duplicates).Float("rate", float32(progress.Rate))
+	if progress.Total > 0 {
+		line = line.Int64("total", progress.Total).Float("percent", float32(progress.Percent)).Str("eta", progress.ETA.String())
+	}
+	line.Msg("progress")
+}
+
+// AddEmpty counts a zero byte file, keep records the path for the report
+func (x *Counters) AddEmpty(filePath string, keep bool) {
+	x.Empty.Add(1)
+	if !keep {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.emptyFiles = append(x.emptyFiles, filePath)
+}
+
+func (x *Counters) EmptyFiles() []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return append([]string(nil), x.emptyFiles...)
+}
+
+// AddReadError counts a file that could not be read, every path is kept since these point at corruption
+func (x *Counters) AddReadError(filePath string) {
+	x.ReadErrors.Add(1)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.unreadableFiles = append(x.unreadableFiles, filePath)
+}
+
+func (x *Counters) UnreadableFiles() []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return append([]string(nil), x.unreadableFiles...)
+}
@@ -0,0 +1,67 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"strconv"
+	"time"
+)
+
+// DateRange limits a run to photos taken between Since and Until, zero values are open ended.
+type DateRange struct {
+	Since          time.Time
+	Until          time.Time
+	IncludeUndated bool
+}
+
+// ParseDateRange accepts YYYY-MM-DD dates, until is inclusive of the whole day
+func ParseDateRange(since, until string, includeUndated bool) (DateRange, error) {
+	dr := DateRange{IncludeUndated: includeUndated}
+	var err error
+	if since != "" {
+		dr.Since, err = time.Parse(time.DateOnly, since)
+		if err != nil {
+			return dr, err
+		}
+	}
+	if until != "" {
+		dr.Until, err = time.Parse(time.DateOnly, until)
+		if err != nil {
+			return dr, err
+		}
+		dr.Until = dr.Until.Add(24 * time.Hour)
+	}
+	return dr, nil
+}
+
+func (x DateRange) IsSet() bool {
+	return !x.Since.IsZero() || !x.Until.IsZero()
+}
+
+func (x DateRange) Contains(fi ImageFileInfo) bool {
+	if !x.IsSet() {
+		return true
+	}
+	createdAt, ok := fi.CreatedAt()
+	if !ok {
+		return x.IncludeUndated
+	}
+	if !x.Since.IsZero() && createdAt.Before(x.Since) {
+		return false
+	}
+	if !x.Until.IsZero() && !createdAt.Before(x.Until) {
+		return false
+	}
+	return true
+}
+
+// CreatedAt returns the EXIF original time, false when the photo is undated
+func (x *ImageFileInfo) CreatedAt() (time.Time, bool) {
+	if x.OriginalDateTime == "" {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(x.OriginalDateTime, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0).UTC(), true
+}
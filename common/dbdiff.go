@@ -0,0 +1,49 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import "sort"
+
+// DBDiff is what changed between an earlier db and the current one, ie. since last month's run
+type DBDiff struct {
+	Old DBStats `json:"old"`
+	New DBStats `json:"new"`
+	// originals only in the new db, and only in the old one
+	Added   []DiffItem `json:"added"`
+	Removed []DiffItem `json:"removed"`
+}
+
+type DiffItem struct {
+	MD5      string `json:"md5"`
+	FileName string `json:"filename"`
+}
+
+// DiffDBs compares by md5 so the dedup scope of either db doesn't matter
+func DiffDBs(old, cur IFastCache) DBDiff {
+	oldItems, curItems := diffItems(old), diffItems(cur)
+	diff := DBDiff{Old: old.Stats(), New: cur.Stats(), Added: make([]DiffItem, 0), Removed: make([]DiffItem, 0)}
+	for md5, item := range curItems {
+		if _, found := oldItems[md5]; !found {
+			diff.Added = append(diff.Added, item)
+		}
+	}
+	for md5, item := range oldItems {
+		if _, found := curItems[md5]; !found {
+			diff.Removed = append(diff.Removed, item)
+		}
+	}
+	// names start with the capture time so this is oldest first
+	for _, items := range [][]DiffItem{diff.Added, diff.Removed} {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].FileName < items[j].FileName
+		})
+	}
+	return diff
+}
+
+func diffItems(db IFastCache) map[string]DiffItem {
+	items := make(map[string]DiffItem)
+	db.ForEach(func(item ImageFileInfo) {
+		items[item.MD5] = DiffItem{MD5: item.MD5, FileName: item.OutputPath()}
+	})
+	return items
+}
@@ -0,0 +1,236 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DBStats are the totals for everything recorded in a db.
+type DBStats struct {
+	Images      int64 `json:"images"`
+	Duplicates  int64 `json:"duplicates"`
+	Exif        int64 `json:"exif"`
+	ExifCorrupt int64 `json:"exifcorrupt"`
+	// extension contradicts the content
+	ExtensionMismatch int64          `json:"extensionmismatch"`
+	Verified          int64          `json:"verified"`
+	OriginalBytes     int64          `json:"originalbytes"`
+	SavedBytes        int64          `json:"savedbytes"`
+	MimeTypes         map[string]int `json:"mimetypes"`
+}
+
+func tallyStats(db IFastCache) DBStats {
+	stats := DBStats{MimeTypes: make(map[string]int)}
+	db.ForEach(func(item ImageFileInfo) {
+		stats.Images += 1
+		stats.Duplicates += int64(item.Duplicates)
+		stats.OriginalBytes += item.Size
+		stats.SavedBytes += item.Size * int64(item.Duplicates)
+		stats.MimeTypes[item.MimeType] += 1
+		if item.HasExif {
+			stats.Exif += 1
+		}
+		if item.ExifError != "" {
+			stats.ExifCorrupt += 1
+		}
+		if item.ExtensionMismatch {
+			stats.ExtensionMismatch += 1
+		}
+		if item.Verified {
+			stats.Verified += 1
+		}
+	})
+	return stats
+}
+
+// SortedMimeTypes lists the mime types most common first
+func (x DBStats) SortedMimeTypes() []string {
+	mimeList := make([]string, 0, len(x.MimeTypes))
+	for mime := range x.MimeTypes {
+		mimeList = append(mimeList, mime)
+	}
+	sort.Slice(mimeList, func(i, j int) bool {
+		if x.MimeTypes[mimeList[i]] != x.MimeTypes[mimeList[j]] {
+			return x.MimeTypes[mimeList[i]] > x.MimeTypes[mimeList[j]]
+		}
+		return mimeList[i] < mimeList[j]
+	})
+	return mimeList
+}
+
+// DuplicateGroup is a kept original and every source path that collapsed into it
+type DuplicateGroup struct {
+	MD5        string   `json:"md5"`
+	FileName   string   `json:"filename"`
+	Original   string   `json:"original"`
+	Duplicates int32    `json:"duplicates"`
+	Paths      []string `json:"paths"`
+	Size       int64    `json:"size"`
+	// bytes taken by the copies beyond the original
+	WastedBytes int64 `json:"wastedbytes"`
+}
+
+// DuplicateGroups lists originals with duplicates, worst offenders first
+func DuplicateGroups(db IFastCache) []DuplicateGroup {
+	groups := make([]DuplicateGroup, 0)
+	db.ForEach(func(item ImageFileInfo) {
+		if item.Duplicates == 0 {
+			return
+		}
+		groups = append(groups, DuplicateGroup{
+			MD5:         item.MD5,
+			FileName:    item.OutputPath(),
+			Original:    item.FilePath,
+			Duplicates:  item.Duplicates,
+			Paths:       item.DuplicatePaths,
+			Size:        item.Size,
+			WastedBytes: item.Size * int64(item.Duplicates),
+		})
+	})
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Duplicates != groups[j].Duplicates {
+			return groups[i].Duplicates > groups[j].Duplicates
+		}
+		return groups[i].MD5 < groups[j].MD5
+	})
+	return groups
+}
+
+// PixelGroup is one image stored as several files, same pixels but a different md5
+type PixelGroup struct {
+	PixelHash string   `json:"pixelhash"`
+	Files     []string `json:"files"`
+}
+
+// PixelGroups lists originals whose pixel hashes match, only -pixel-hash runs record them
+func PixelGroups(db IFastCache) []PixelGroup {
+	byPixels := make(map[string][]string)
+	db.ForEach(func(item ImageFileInfo) {
+		if item.PixelHash != "" {
+			byPixels[item.PixelHash] = append(byPixels[item.PixelHash], item.OutputPath())
+		}
+	})
+	groups := make([]PixelGroup, 0)
+	for pixelHash, files := range byPixels {
+		if len(files) < 2 {
+			continue
+		}
+		sort.Strings(files)
+		groups = append(groups, PixelGroup{PixelHash: pixelHash, Files: files})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Files[0] < groups[j].Files[0]
+	})
+	return groups
+}
+
+// WastedSpace is how much a cleanup of the duplicates would reclaim
+type WastedSpace struct {
+	TotalBytes int64 `json:"totalbytes"`
+	// largest wasters first
+	Groups []DuplicateGroup `json:"groups"`
+	// wasted bytes by the source directory holding the duplicates
+	Folders map[string]int64 `json:"folders"`
+}
+
+func FlattenDuplicates(db IFastCache) WastedSpace {
+	wasted := WastedSpace{Groups: DuplicateGroups(db), Folders: make(map[string]int64)}
+	for _, group := range wasted.Groups {
+		wasted.TotalBytes += group.WastedBytes
+		for _, filePath := range group.Paths {
+			wasted.Folders[filepath.Dir(filePath)] += group.Size
+		}
+	}
+	sort.SliceStable(wasted.Groups, func(i, j int) bool {
+		return wasted.Groups[i].WastedBytes > wasted.Groups[j].WastedBytes
+	})
+	return wasted
+}
+
+// SortedFolders lists the folders wasting the most space first
+func (x WastedSpace) SortedFolders() []string {
+	folders := make([]string, 0, len(x.Folders))
+	for folder := range x.Folders {
+		folders = append(folders, folder)
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		if x.Folders[folders[i]] != x.Folders[folders[j]] {
+			return x.Folders[folders[i]] > x.Folders[folders[j]]
+		}
+		return folders[i] < folders[j]
+	})
+	return folders
+}
+
+// Histogram buckets the originals by capture date for -histogram
+type Histogram string
+
+const (
+	HistogramNone  Histogram = ""
+	HistogramYear  Histogram = "year"
+	HistogramMonth Histogram = "month"
+)
+
+func ParseHistogram(by string) (Histogram, error) {
+	switch Histogram(by) {
+	case HistogramNone, HistogramYear, HistogramMonth:
+		return Histogram(by), nil
+	}
+	return "", errors.New("unknown histogram " + by)
+}
+
+// UndatedBucket holds the originals without a capture date
+const UndatedBucket = "undated"
+
+// DateBucket is the number of originals taken in one year or month
+type DateBucket struct {
+	Bucket string `json:"bucket"`
+	Count  int64  `json:"count"`
+}
+
+// DateHistogram counts originals per year or month, oldest first. Empty buckets between the
+// first and last date are kept so a missing stretch shows, undated originals come last.
+func DateHistogram(db IFastCache, by Histogram) []DateBucket {
+	layout := "2006"
+	if by == HistogramMonth {
+		layout = "2006-01"
+	}
+	counts := make(map[string]int64)
+	var first, last time.Time
+	undated := int64(0)
+	db.ForEach(func(item ImageFileInfo) {
+		createdAt, dated := item.CreatedAt()
+		if !dated {
+			undated++
+			return
+		}
+		counts[createdAt.Format(layout)]++
+		if first.IsZero() || createdAt.Before(first) {
+			first = createdAt
+		}
+		if createdAt.After(last) {
+			last = createdAt
+		}
+	})
+
+	buckets := make([]DateBucket, 0)
+	if !first.IsZero() {
+		step := func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }
+		bucket := time.Date(first.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		if by == HistogramMonth {
+			step = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+			bucket = time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC)
+		}
+		for ; !bucket.After(last); bucket = step(bucket) {
+			name := bucket.Format(layout)
+			buckets = append(buckets, DateBucket{Bucket: name, Count: counts[name]})
+		}
+	}
+	if undated > 0 {
+		buckets = append(buckets, DateBucket{Bucket: UndatedBucket, Count: undated})
+	}
+	return buckets
+}
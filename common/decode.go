@@ -0,0 +1,136 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+
+	"github.com/dsoprea/go-exif/v3"
+)
+
+// mime types the standard library can decode, the rest can't be validated
+var decodableTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+func CanDecode(mime string) bool {
+	return decodableTypes[mime]
+}
+
+// DecodeImage fully decodes the file, truncated or bit rotted images pass the magic check but fail here
+func (x *FileSystem) DecodeImage(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return unreadable(err)
+	}
+	defer file.Close()
+
+	_, _, err = image.Decode(file)
+	return err
+}
+
+// ImageDimensions reads width and height from the header for jpeg, png and gif and
+// from the EXIF PixelXDimension/PixelYDimension tags for everything else
+func (x *FileSystem) ImageDimensions(filePath, mime string) (width, height int, err error) {
+	if CanDecode(mime) {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return 0, 0, unreadable(err)
+		}
+		defer file.Close()
+
+		config, _, err := image.DecodeConfig(file)
+		if err != nil {
+			return 0, 0, err
+		}
+		return config.Width, config.Height, nil
+	}
+
+	defer recoverExif(x.logger(), filePath, &err)
+	rawExif, err := exif.SearchFileAndExtractExif(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	tags, _, err := exif.GetFlatExifData(rawExif, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %w", ErrExifCorrupt, err)
+	}
+	for _, tag := range tags {
+		switch tag.TagName {
+		case "PixelXDimension":
+			width = exifInt(tag.Value)
+		case "PixelYDimension":
+			height = exifInt(tag.Value)
+		}
+	}
+	if width == 0 || height == 0 {
+		return 0, 0, errors.New("no dimensions in exif")
+	}
+	return width, height, nil
+}
+
+// exifInt reads SHORT or LONG tag values, go-exif hands them back as slices
+func exifInt(value interface{}) int {
+	switch v := value.(type) {
+	case []uint16:
+		if len(v) > 0 {
+			return int(v[0])
+		}
+	case []uint32:
+		if len(v) > 0 {
+			return int(v[0])
+		}
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	}
+	return 0
+}
+
+// exifString reads ASCII tag values, malformed ones come back as a slice or a non-string type
+func exifString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []string:
+		if len(v) > 0 {
+			return v[0], true
+		}
+	}
+	return "", false
+}
+
+// PixelHash is the md5 of the decoded RGBA pixels, the same photo re-saved or stripped of
+// its EXIF hashes the same here while the file md5 differs
+func (x *FileSystem) PixelHash(filePath, mime string) (string, error) {
+	if !CanDecode(mime) {
+		return "", errors.New("can't decode " + mime)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", unreadable(err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", err
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	hash := md5.Sum(rgba.Pix)
+	return hex.EncodeToString(hash[:]), nil
+}
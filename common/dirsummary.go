@@ -0,0 +1,50 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// dirSummary is the counters as they were when the walk entered dir
+type dirSummary struct {
+	dir          string
+	files        int64
+	images       int64
+	duplicates   int64
+	unrecognized int64
+}
+
+// openDir starts a summary for a directory the walk just entered
+func (x *Processor) openDir(dir string) {
+	x.dirs = append(x.dirs, dirSummary{
+		dir:          dir,
+		files:        x.counters.Files.Load(),
+		images:       x.images,
+		duplicates:   x.counters.Duplicates.Load(),
+		unrecognized: x.counters.Unrecognized.Load(),
+	})
+}
+
+// leaveDirs logs the directories the walk is done with, the walk is depth first so that is every
+// open one filePath isn't inside. An empty filePath closes them all. Counts include sub folders.
+func (x *Processor) leaveDirs(filePath string) {
+	for len(x.dirs) > 0 {
+		last := x.dirs[len(x.dirs)-1]
+		if filePath != "" && (filePath == last.dir || strings.HasPrefix(filePath, last.dir+string(filepath.Separator))) {
+			return
+		}
+		x.dirs = x.dirs[:len(x.dirs)-1]
+		// nothing but sub folders or skipped entries isn't worth a line
+		files := x.counters.Files.Load() - last.files
+		if files == 0 {
+			continue
+		}
+		x.logger.Info().Str("photoz", "dir").Str("dir", last.dir).
+			Int64("files", files).
+			Int64("images", x.images-last.images).
+			Int64("duplicates", x.counters.Duplicates.Load()-last.duplicates).
+			Int64("unrecognized", x.counters.Unrecognized.Load()-last.unrecognized).
+			Msg("directory done")
+	}
+}
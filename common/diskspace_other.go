@@ -0,0 +1,10 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+//go:build !linux && !darwin && !freebsd
+
+package common
+
+import "errors"
+
+func (x *FileSystem) AvailableBytes(path string) (uint64, error) {
+	return 0, errors.New("free space check not supported on this platform")
+}
@@ -0,0 +1,14 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+//go:build linux || darwin || freebsd
+
+package common
+
+import "syscall"
+
+func (x *FileSystem) AvailableBytes(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
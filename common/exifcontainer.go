@@ -0,0 +1,313 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dsoprea/go-exif/v3"
+)
+
+// EXIF blocks are small, anything bigger is a damaged container
+const maxExifBytes = 16 * 1024 * 1024
+
+var exifPrefix = []byte("Exif\x00\x00")
+
+// readRawExif returns the EXIF block starting at its TIFF header. WebP keeps it in an EXIF chunk and
+// AVIF in an Exif item, every other format is left to the go-exif byte search.
+func readRawExif(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return exif.SearchFileAndExtractExif(filePath)
+	}
+	switch {
+	case string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return webpExif(file)
+	// HEIC still goes through the byte search
+	case string(header[4:8]) == "ftyp" && ftypBrands[string(header[8:12])] == "image/avif":
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return heifExif(file, info.Size())
+	}
+	return exif.SearchFileAndExtractExif(filePath)
+}
+
+// webpExif walks the RIFF chunks after the WEBP form type looking for EXIF
+func webpExif(r io.ReadSeeker) ([]byte, error) {
+	if _, err := r.Seek(12, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, exif.ErrNoExif
+			}
+			return nil, err
+		}
+		size := int64(binary.LittleEndian.Uint32(header[4:]))
+		if string(header[:4]) == "EXIF" {
+			if size > maxExifBytes {
+				return nil, fmt.Errorf("webp exif chunk of %d bytes", size)
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, err
+			}
+			// some writers keep the JPEG APP1 prefix
+			return bytes.TrimPrefix(data, exifPrefix), nil
+		}
+		// chunks are padded to an even size
+		if _, err := r.Seek(size+size&1, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+}
+
+var errBadBox = errors.New("malformed heif box")
+
+type heifBox struct {
+	kind       string
+	start, end int64
+}
+
+// heifBoxes lists the boxes between start and end, start and end of each is its payload
+func heifBoxes(r io.ReaderAt, start, end int64) ([]heifBox, error) {
+	boxes := make([]heifBox, 0)
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		size, payload := int64(binary.BigEndian.Uint32(header[:4])), offset+8
+		switch size {
+		case 0:
+			// runs to the end of the enclosing box
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			size, payload = int64(binary.BigEndian.Uint64(header[8:16])), offset+16
+		}
+		if size < payload-offset || offset+size > end {
+			return nil, errBadBox
+		}
+		boxes = append(boxes, heifBox{kind: string(header[4:8]), start: payload, end: offset + size})
+		offset += size
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []heifBox, kind string) (heifBox, bool) {
+	for _, box := range boxes {
+		if box.kind == kind {
+			return box, true
+		}
+	}
+	return heifBox{}, false
+}
+
+func readBox(r io.ReaderAt, box heifBox) ([]byte, error) {
+	if box.end-box.start > maxExifBytes {
+		return nil, errBadBox
+	}
+	data := make([]byte, box.end-box.start)
+	if _, err := r.ReadAt(data, box.start); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// heifExif finds the Exif item in meta/iinf and reads its extents from meta/iloc
+func heifExif(r io.ReaderAt, size int64) ([]byte, error) {
+	top, err := heifBoxes(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	meta, found := findBox(top, "meta")
+	if !found {
+		return nil, exif.ErrNoExif
+	}
+	// meta is a full box, version and flags come first
+	children, err := heifBoxes(r, meta.start+4, meta.end)
+	if err != nil {
+		return nil, err
+	}
+	iinf, foundInf := findBox(children, "iinf")
+	iloc, foundLoc := findBox(children, "iloc")
+	if !foundInf || !foundLoc {
+		return nil, exif.ErrNoExif
+	}
+
+	infData, err := readBox(r, iinf)
+	if err != nil {
+		return nil, err
+	}
+	itemID, found, err := exifItemID(infData)
+	if err != nil || !found {
+		if err == nil {
+			err = exif.ErrNoExif
+		}
+		return nil, err
+	}
+
+	locData, err := readBox(r, iloc)
+	if err != nil {
+		return nil, err
+	}
+	extents, err := itemExtents(locData, itemID)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	for _, extent := range extents {
+		if extent[1] <= 0 || int64(len(data))+extent[1] > maxExifBytes {
+			return nil, errBadBox
+		}
+		chunk := make([]byte, extent[1])
+		if _, err := r.ReadAt(chunk, extent[0]); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+
+	// the item opens with the offset of the TIFF header past these four bytes
+	if len(data) < 4 {
+		return nil, errBadBox
+	}
+	tiffOffset := int64(binary.BigEndian.Uint32(data[:4]))
+	if 4+tiffOffset > int64(len(data)) {
+		return nil, errBadBox
+	}
+	return bytes.TrimPrefix(data[4+tiffOffset:], exifPrefix), nil
+}
+
+// boxReader reads the big endian fields of a box payload, a short payload sets err instead of panicking
+type boxReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (x *boxReader) uint(n int) uint64 {
+	if x.err != nil || n == 0 {
+		return 0
+	}
+	if n > 8 || x.pos+n > len(x.data) {
+		x.err = errBadBox
+		return 0
+	}
+	var v uint64
+	for _, b := range x.data[x.pos : x.pos+n] {
+		v = v<<8 | uint64(b)
+	}
+	x.pos += n
+	return v
+}
+
+// exifItemID looks through the infe entries of an iinf payload for the Exif item
+func exifItemID(iinf []byte) (uint64, bool, error) {
+	r := &boxReader{data: iinf}
+	version := r.uint(1)
+	r.uint(3)
+	if version == 0 {
+		r.uint(2)
+	} else {
+		r.uint(4)
+	}
+	if r.err != nil {
+		return 0, false, r.err
+	}
+	entries, err := heifBoxes(bytes.NewReader(iinf), int64(r.pos), int64(len(iinf)))
+	if err != nil {
+		return 0, false, err
+	}
+	for _, entry := range entries {
+		if entry.kind != "infe" {
+			continue
+		}
+		e := &boxReader{data: iinf[entry.start:entry.end]}
+		infeVersion := e.uint(1)
+		e.uint(3)
+		// older infe versions have no item type
+		if infeVersion < 2 {
+			continue
+		}
+		var id uint64
+		if infeVersion == 2 {
+			id = e.uint(2)
+		} else {
+			id = e.uint(4)
+		}
+		e.uint(2)
+		itemType := e.uint(4)
+		if e.err == nil && itemType == uint64(binary.BigEndian.Uint32([]byte("Exif"))) {
+			return id, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// itemExtents returns the file offset and length of each extent of an item in an iloc payload
+func itemExtents(iloc []byte, itemID uint64) ([][2]int64, error) {
+	r := &boxReader{data: iloc}
+	version := r.uint(1)
+	r.uint(3)
+	sizes := r.uint(2)
+	offsetSize, lengthSize, baseOffsetSize := int(sizes>>12&0xf), int(sizes>>8&0xf), int(sizes>>4&0xf)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xf)
+	}
+	var itemCount uint64
+	if version < 2 {
+		itemCount = r.uint(2)
+	} else {
+		itemCount = r.uint(4)
+	}
+	for i := uint64(0); i < itemCount && r.err == nil; i++ {
+		var id uint64
+		if version < 2 {
+			id = r.uint(2)
+		} else {
+			id = r.uint(4)
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = r.uint(2) & 0xf
+		}
+		r.uint(2)
+		base := int64(r.uint(baseOffsetSize))
+		extentCount := r.uint(2)
+		extents := make([][2]int64, 0, 1)
+		for j := uint64(0); j < extentCount && r.err == nil; j++ {
+			r.uint(indexSize)
+			offset, length := int64(r.uint(offsetSize)), int64(r.uint(lengthSize))
+			extents = append(extents, [2]int64{base + offset, length})
+		}
+		if r.err == nil && id == itemID {
+			// only offsets into the file itself, not into idat or other items
+			if method != 0 {
+				return nil, fmt.Errorf("heif exif construction method %d not supported", method)
+			}
+			return extents, nil
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return nil, exif.ErrNoExif
+}
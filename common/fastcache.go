@@ -2,28 +2,57 @@
 package common
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"io"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/osintami/sloan/log"
 	"github.com/patrickmn/go-cache"
 )
 
 type IFastCache interface {
-	Get(key string, obj interface{}) (interface{}, bool)
+	Get(key string, obj ImageFileInfo) (interface{}, bool)
 	Set(key string, value interface{}, duration time.Duration)
+	// SetIfAbsent stores value only when key is new, otherwise it returns what is stored
+	SetIfAbsent(key string, value ImageFileInfo) (ImageFileInfo, bool)
+	Delete(pattern string)
+	// Remove drops exactly key, Delete matches any key containing the pattern
+	Remove(key string)
 	Clear()
 	Persist() error
+	List() []string
+	Keys() []string
+	ForEach(fn func(ImageFileInfo))
+	Stats() DBStats
 	ToJSON(string) error
-	toJson(interface{})
-	fromJson(interface{})
+	ToJSONL(io.Writer) error
+	Tombstone(md5 string)
+	IsTombstoned(md5 string) bool
+	// Tombstones are the tombstoned md5s
+	Tombstones() []string
+}
+
+var (
+	_ IFastCache = (*FastCache)(nil)
+	_ IFastCache = (*BoltCache)(nil)
+)
+
+// tombstones share the cache under this prefix, the NUL keeps them apart from any md5 or dir key
+const tombstonePrefix = "\x00tombstone:"
+
+func isTombstoneKey(key string) bool {
+	return strings.HasPrefix(key, tombstonePrefix)
 }
 
 type FastCache struct {
 	persistFile string
 	cache       *cache.Cache
+	logTo       Logger
 }
 
 func NewFastCache() *FastCache {
@@ -34,7 +63,7 @@ func NewPersistentCache(persistFile string) (*FastCache, error) {
 	x := &FastCache{
 		persistFile: persistFile,
 		cache:       cache.New(24*time.Hour, 60*time.Minute)}
-	return x, x.cache.LoadFile(persistFile)
+	return x, x.loadFile(persistFile)
 }
 
 func (x *FastCache) Get(key string, obj ImageFileInfo) (interface{}, bool) {
@@ -42,7 +71,7 @@ func (x *FastCache) Get(key string, obj ImageFileInfo) (interface{}, bool) {
 	if found {
 		obj, err := x.fromJSON(jsonString.(string), obj)
 		if err != nil {
-			log.Error().Err(err).Str("fastcache", "get").Msg("toJson")
+			x.logger().Error().Err(err).Str("fastcache", "get").Msg("toJson")
 			return nil, false
 		}
 		return obj, true
@@ -53,23 +82,98 @@ func (x *FastCache) Get(key string, obj ImageFileInfo) (interface{}, bool) {
 func (x *FastCache) Set(key string, value interface{}, duration time.Duration) {
 	jsonString, err := x.toJSON(value)
 	if err != nil {
-		log.Error().Err(err).Str("fastcache", "set").Msg("fromJson")
+		x.logger().Error().Err(err).Str("fastcache", "set").Msg("fromJson")
 		return
 	}
 	x.cache.Set(key, jsonString, duration)
 }
 
+func (x *FastCache) SetIfAbsent(key string, value ImageFileInfo) (ImageFileInfo, bool) {
+	jsonString, err := x.toJSON(value)
+	if err != nil {
+		x.logger().Error().Err(err).Str("fastcache", "setifabsent").Msg("fromJson")
+		return value, false
+	}
+	// Add fails when the key exists
+	if x.cache.Add(key, jsonString, cache.NoExpiration) == nil {
+		return value, true
+	}
+	if obj, found := x.Get(key, ImageFileInfo{}); found {
+		return obj.(ImageFileInfo), false
+	}
+	// deleted in between or unreadable, the new value takes its place
+	x.cache.Set(key, jsonString, cache.NoExpiration)
+	return value, true
+}
+
 func (x *FastCache) LoadFile(fileName string) *FastCache {
-	x.cache.LoadFile(fileName)
+	x.loadFile(fileName)
 	return x
 }
 
 func (x *FastCache) Save(fileName string) error {
-	return x.cache.SaveFile(fileName)
+	return x.saveFile(fileName)
 }
 
 func (x *FastCache) Persist() error {
-	return x.cache.SaveFile(x.persistFile)
+	return x.saveFile(x.persistFile)
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// loadFile reads both gzip compressed and older uncompressed db files
+func (x *FastCache) loadFile(fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = bufio.NewReader(file)
+	magic, _ := r.(*bufio.Reader).Peek(len(gzipMagic))
+	if bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return x.cache.Load(r)
+}
+
+// saveFile writes a temp file and renames it over the db, a crash mid save leaves the old db intact
+func (x *FastCache) saveFile(fileName string) error {
+	tmpFile := fileName + ".tmp"
+	file, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(file)
+	err = x.cache.Save(gz)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, fileName)
+}
+
+// SetAutoPersist saves the db every interval until stop is called
+func (x *FastCache) SetAutoPersist(interval time.Duration) (stop func()) {
+	return every(interval, func() {
+		if err := x.Persist(); err != nil {
+			x.logger().Error().Err(err).Str("fastcache", "persist").Str("file", x.persistFile).Msg("auto persist")
+		}
+	})
 }
 
 func (x *FastCache) Clear() {
@@ -80,33 +184,164 @@ func (x *FastCache) Clear() {
 
 func (x *FastCache) Delete(pattern string) {
 	for k := range x.cache.Items() {
-		if strings.Contains(k, pattern) {
+		if strings.Contains(k, pattern) && !isTombstoneKey(k) {
 			x.cache.Delete(k)
 		}
 	}
 }
 
+func (x *FastCache) Remove(key string) {
+	x.cache.Delete(key)
+}
+
 func (x *FastCache) List() []string {
 	out := make([]string, 0)
-	for _, v := range x.cache.Items() {
+	for k, v := range x.cache.Items() {
+		if isTombstoneKey(k) {
+			continue
+		}
 		out = append(out, v.Object.(string))
 	}
 	return out
 }
 
+// Keys are the md5s, or dir plus md5 with -dedup-scope dir, without decoding any values
+func (x *FastCache) Keys() []string {
+	out := make([]string, 0)
+	for k := range x.cache.Items() {
+		if isTombstoneKey(k) {
+			continue
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+// ForEach decodes one entry at a time so callers can tally without copying the whole db.
+func (x *FastCache) ForEach(fn func(ImageFileInfo)) {
+	for k, v := range x.cache.Items() {
+		if isTombstoneKey(k) {
+			continue
+		}
+		obj := ImageFileInfo{}
+		if err := json.Unmarshal([]byte(v.Object.(string)), &obj); err != nil {
+			x.logger().Error().Err(err).Str("fastcache", "foreach").Str("key", k).Msg("fromJson")
+			continue
+		}
+		fn(obj)
+	}
+}
+
+func (x *FastCache) Stats() DBStats {
+	return tallyStats(x)
+}
+
 func (x *FastCache) ToJSON(fileName string) error {
 	out := make([]interface{}, 0)
-	for _, v := range x.cache.Items() {
+	for k, v := range x.cache.Items() {
+		if isTombstoneKey(k) {
+			continue
+		}
 		out = append(out, v.Object)
 	}
 	json, _ := json.MarshalIndent(out, "", "    ")
 	return os.WriteFile(fileName, []byte(json), 0644)
 }
 
+// ToJSONL streams one compact JSON object per line instead of building one big array
+func (x *FastCache) ToJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for k, v := range x.cache.Items() {
+		if isTombstoneKey(k) {
+			continue
+		}
+		if _, err := bw.WriteString(v.Object.(string) + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Tombstone marks an md5 as deliberately excluded, later runs skip it even when the file comes back.
+// The value is when it was marked.
+func (x *FastCache) Tombstone(md5 string) {
+	x.cache.Set(tombstonePrefix+md5, time.Now().UTC().Format(time.RFC3339), -1)
+}
+
+func (x *FastCache) IsTombstoned(md5 string) bool {
+	_, found := x.cache.Get(tombstonePrefix + md5)
+	return found
+}
+
+func (x *FastCache) Tombstones() []string {
+	out := make([]string, 0)
+	for k := range x.cache.Items() {
+		if isTombstoneKey(k) {
+			out = append(out, strings.TrimPrefix(k, tombstonePrefix))
+		}
+	}
+	return out
+}
+
+// Merge folds other into this cache, see MergeCaches
+func (x *FastCache) Merge(other IFastCache) int {
+	return MergeCaches(x, other)
+}
+
+// MergeCaches unions src into dst and returns how many entries were added. When both have a key
+// the earliest dated entry wins, the other copy becomes one more duplicate of it. Tombstones carry over.
+func MergeCaches(dst, src IFastCache) int {
+	for _, md5 := range src.Tombstones() {
+		dst.Tombstone(md5)
+	}
+	added := 0
+	// keys first, they keep a -dedup-scope dir entry under its dir and a bolt db can't be written from inside ForEach
+	for _, key := range src.Keys() {
+		obj, found := src.Get(key, ImageFileInfo{})
+		if !found {
+			continue
+		}
+		item := obj.(ImageFileInfo)
+		stored, found := dst.Get(key, ImageFileInfo{})
+		if !found {
+			dst.Set(key, item, -1)
+			added += 1
+			continue
+		}
+		keep, other := stored.(ImageFileInfo), item
+		if earlier(other, keep) {
+			keep, other = other, keep
+		}
+		// the same file, ie. a db merged in twice, is not a duplicate of itself
+		if other.FilePath == keep.FilePath || slices.Contains(keep.DuplicatePaths, other.FilePath) {
+			continue
+		}
+		keep.Duplicates += other.Duplicates + 1
+		keep.DuplicatePaths = append(keep.DuplicatePaths, other.FilePath)
+		for _, duplicatePath := range other.DuplicatePaths {
+			if !slices.Contains(keep.DuplicatePaths, duplicatePath) {
+				keep.DuplicatePaths = append(keep.DuplicatePaths, duplicatePath)
+			}
+		}
+		dst.Set(key, keep, -1)
+	}
+	return added
+}
+
+// earlier reports whether a was taken before b, undated entries sort last
+func earlier(a, b ImageFileInfo) bool {
+	aTime, aDated := a.CreatedAt()
+	bTime, bDated := b.CreatedAt()
+	if aDated != bDated {
+		return aDated
+	}
+	return aDated && aTime.Before(bTime)
+}
+
 func (x *FastCache) toJSON(fi interface{}) (string, error) {
 	jsonData, err := json.Marshal(fi)
 	if err != nil {
-		log.Error().Err(err).Str("photoz", "json").Msg("marshall JSON")
+		x.logger().Error().Err(err).Str("photoz", "json").Msg("marshall JSON")
 		return "", err
 	}
 	return string(jsonData), nil
@@ -116,3 +351,12 @@ func (x *FastCache) fromJSON(jsonString string, obj ImageFileInfo) (interface{},
 	err := json.Unmarshal([]byte(jsonString), &obj)
 	return obj, err
 }
+
+// SetLogger sends the cache's log lines to logger instead of the global sloan log
+func (x *FastCache) SetLogger(logger Logger) {
+	x.logTo = logger
+}
+
+func (x *FastCache) logger() Logger {
+	return loggerOr(x.logTo)
+}
@@ -0,0 +1,73 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestMergeCaches(t *testing.T) {
+	dst, src := NewFastCache(), NewFastCache()
+	original := NewImageFileInfo("/a/photo.jpg", "image/jpeg", "abc")
+	original.OriginalDateTime = "1000"
+	dst.Set("abc", original, -1)
+	// the same file again, ie. the db merged into itself
+	src.Set("abc", original, -1)
+	// a dir-scoped key must come back under itself, not the bare md5
+	scoped := NewImageFileInfo("/b/photo.jpg", "image/jpeg", "def")
+	src.Set(filepath.Join("/b", "def"), scoped, -1)
+	src.Tombstone("dead")
+
+	if added := MergeCaches(dst, src); added != 1 {
+		t.Fatalf("added %d, want 1", added)
+	}
+	obj, _ := dst.Get("abc", ImageFileInfo{})
+	if kept := obj.(ImageFileInfo); kept.Duplicates != 0 || len(kept.DuplicatePaths) != 0 {
+		t.Errorf("same file counted as a duplicate: %d %v", kept.Duplicates, kept.DuplicatePaths)
+	}
+	if _, found := dst.Get(filepath.Join("/b", "def"), ImageFileInfo{}); !found {
+		t.Error("dir-scoped entry not under its source key")
+	}
+	if _, found := dst.Get("def", ImageFileInfo{}); found {
+		t.Error("dir-scoped entry stored under the bare md5")
+	}
+	if !dst.IsTombstoned("dead") {
+		t.Error("tombstone not carried over")
+	}
+
+	// a real duplicate counts once no matter how often it is merged
+	copied := NewImageFileInfo("/c/photo.jpg", "image/jpeg", "abc")
+	copied.OriginalDateTime = "2000"
+	other := NewFastCache()
+	other.Set("abc", copied, -1)
+	MergeCaches(dst, other)
+	MergeCaches(dst, other)
+	obj, _ = dst.Get("abc", ImageFileInfo{})
+	if kept := obj.(ImageFileInfo); kept.FilePath != "/a/photo.jpg" || kept.Duplicates != 1 || len(kept.DuplicatePaths) != 1 {
+		t.Errorf("kept %s with %d duplicates %v, want /a/photo.jpg with 1", kept.FilePath, kept.Duplicates, kept.DuplicatePaths)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	bolt, err := NewBoltCache(filepath.Join(t.TempDir(), "photoz.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+
+	scoped := filepath.Join("/a", "def")
+	for name, db := range map[string]IFastCache{"fastcache": NewFastCache(), "boltcache": bolt} {
+		t.Run(name, func(t *testing.T) {
+			db.Set("abc", NewImageFileInfo("/a/photo.jpg", "image/jpeg", "abc"), -1)
+			db.Set(scoped, NewImageFileInfo("/a/other.jpg", "image/jpeg", "def"), -1)
+			db.Tombstone("dead")
+
+			keys := db.Keys()
+			sort.Strings(keys)
+			if len(keys) != 2 || keys[0] != scoped || keys[1] != "abc" {
+				t.Fatalf("keys %q, want %q", keys, []string{scoped, "abc"})
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+//go:build !linux && !darwin && !freebsd
+
+package common
+
+import "os"
+
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// no inode identity here, directories are never treated as already visited
+func fileIdentity(fi os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,23 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+//go:build linux || darwin || freebsd
+
+package common
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID is the device and inode pair, the same directory reached twice has the same one
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func fileIdentity(fi os.FileInfo) (fileID, bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
@@ -2,21 +2,115 @@
 package common
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-
-	"github.com/osintami/sloan/log"
+	"syscall"
+	"time"
 )
 
 type FileSystem struct {
 	BasePath string
+	// read buffer used while hashing, large reads suit big NEF and video files on spinning disks
+	HashBufferSize int
+	// write buffer used while copying, larger suits big media on fast storage
+	CopyBufferSize int
+	// permissions given to copied originals
+	FilePerm fs.FileMode
+	// permissions for directories created in the output, the umask still applies
+	DirPerm fs.FileMode
+	// extra attempts for copies failing with transient errors
+	Retries int
+	// file name globs that are never photos, ie. ._* or *.tmp, see DefaultIgnoreNames
+	IgnoreNames []string
+	// nil logs to the global sloan log
+	Logger Logger
+}
+
+func (x *FileSystem) logger() Logger {
+	return loggerOr(x.Logger)
+}
+
+// DefaultIgnoreNames are Apple resource forks and the OS folder droppings that sniff like images
+var DefaultIgnoreNames = []string{"._*", ".DS_Store", "Thumbs.db"}
+
+// IFileSystem is everything the Processor does to files, so a fake can stand in for the disk
+type IFileSystem interface {
+	IgnoreByName(filePath string) (bool, string)
+	IgnoreByExtension(filePath string) (bool, string)
+	IsImage(filePath string) (bool, string, error)
+	CalculateMD5(ctx context.Context, filePath string) (string, error)
+	PrefixMD5(ctx context.Context, filePath string, n int64) (string, error)
+	CopyFile(ctx context.Context, inFile, outFile string) error
+	LinkFile(ctx context.Context, inFile, outFile string, mode LinkMode) error
+	ConvertFile(src, dst, targetFormat string, orientation int) error
+	HasCopy(ctx context.Context, outFile string, size int64, md5 string) bool
+	MkdirAll(dir string) error
+	DeleteFile(inFile string) error
+	WriteSidecar(outFile string, fi ImageFileInfo) error
+	ExtractPreview(filePath, mime string) ([]byte, error)
+	WritePreview(outFile string, preview []byte) error
+	FindAAE(filePath string) (string, bool)
+	FindLivePhotoPartner(filePath string) (string, bool)
+	TakeoutTime(filePath string) (time.Time, bool)
+	ImageDimensions(filePath, mime string) (int, int, error)
+	PixelHash(filePath, mime string) (string, error)
+	DecodeImage(filePath string) error
+	AvailableBytes(path string) (uint64, error)
+	// the walk, lists, ignore files, journal and renames read and write through these
+	Walk(root string, fn filepath.WalkFunc) error
+	Stat(name string) (fs.FileInfo, error)
+	EvalSymlinks(path string) (string, error)
+	Open(name string) (io.ReadCloser, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Glob(pattern string) ([]string, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (io.WriteCloser, error)
+	Rename(oldPath, newPath string) error
+}
+
+var _ IFileSystem = (*FileSystem)(nil)
+
+const (
+	defaultHashBufferSize = 1024 * 1024
+	defaultCopyBufferSize = 32 * 1024
+	defaultFilePerm       = 0644
+	defaultDirPerm        = 0755
+	defaultRetries        = 2
+	retryDelay            = 500 * time.Millisecond
+)
+
+type LinkMode string
+
+const (
+	LinkCopy LinkMode = "copy"
+	LinkHard LinkMode = "hard"
+	LinkSoft LinkMode = "soft"
+	// the source is renamed into place, input and output must share a volume
+	LinkMove LinkMode = "move"
+)
+
+func ParseLinkMode(mode string) (LinkMode, error) {
+	switch LinkMode(mode) {
+	case LinkCopy, LinkHard, LinkSoft, LinkMove:
+		return LinkMode(mode), nil
+	}
+	return "", errors.New("unknown link mode " + mode)
 }
 
 var skipExtensions = map[string]string{
@@ -24,6 +118,7 @@ var skipExtensions = map[string]string{
 	".htm":      "htm",
 	".doc":      "doc",
 	".db":       "db",
+	".journal":  "journal", // photoz crash journal
 	".jbf":      "jbf",
 	".dot":      "dot",
 	".txt":      "txt",
@@ -56,148 +151,527 @@ var skipExtensions = map[string]string{
 	".xmp":      "xmp",
 	".rtf":      "rtf",
 	".json":     "json",
+	".aae":      "aae", // Apple edit instructions, copied with their photo by -include-aae
 	// consider re-enabling once we fix other issues
 	"mjpg": "mjpg",
 }
 
-var imageSignatures = map[string]string{
-	"ftypisom":                         "video/mp4",       // MPEG4
-	"ftypMSNV":                         "video/mp4",       // MPEG4
-	"\xff\xd8\xff":                     "image/jpeg",      // JPEG
-	"GIF87a":                           "image/gif",       // GIF
-	"GIF89a":                           "image/gif",       // GIF
-	"BM":                               "image/bmp",       // BMP
-	"II*\x00":                          "image/tiff",      // TIFF (little-endian)
-	"MM\x00*":                          "image/tiff",      // TIFF (big-endian)
-	"RIFF....WEBP":                     "image/webp",      // WEBP
-	"\x52\x49\x46\x46":                 "video/x-msvideo", // AVI
-	"\x7B\x5C\x72\x74\x66\x31":         "application/rtf", // RTF
-	"\x49\x44\x33":                     "audio/mpeg",      // MP3
-	"\x00\x00\x00\x28ftypheic":         "image/heic",      // HEIC
-	"\x89\x50\x4E\x47\x0D\x0A\x1A\x0A": "image/png",       // PNG or NEF WTF???
+type signature struct {
+	magic string
+	mime  string
+}
+
+// checked longest first so the most specific signature wins
+var imageSignatures = []signature{
+	{"ftypisom", "video/mp4"},                         // MPEG4
+	{"ftypMSNV", "video/mp4"},                         // MPEG4
+	{"\xff\xd8\xff", "image/jpeg"},                    // JPEG
+	{"GIF87a", "image/gif"},                           // GIF
+	{"GIF89a", "image/gif"},                           // GIF
+	{"BM", "image/bmp"},                               // BMP
+	{"II*\x00", "image/tiff"},                         // TIFF (little-endian)
+	{"MM\x00*", "image/tiff"},                         // TIFF (big-endian)
+	{"IIRO\x08\x00", "image/tiff"},                    // ORF (TIFF with an Olympus magic)
+	{"IIRS\x08\x00", "image/tiff"},                    // ORF
+	{"MMOR\x00\x00", "image/tiff"},                    // ORF (big-endian)
+	{"\x7B\x5C\x72\x74\x66\x31", "application/rtf"},   // RTF
+	{"\x49\x44\x33", "audio/mpeg"},                    // MP3
+	{"\x00\x00\x00\x28ftypheic", "image/heic"},        // HEIC
+	{"\x89\x50\x4E\x47\x0D\x0A\x1A\x0A", "image/png"}, // PNG
 	// consider re-enabling once we fix other issues
-	//"\x0D\x0A\x0D\x0A\x2D\x2D\x6D\x79\x62\x6F\x75\x6E\x64\x61\x72\x79": "video/mjpeg", // MJPEG
+	//{"\x0D\x0A\x0D\x0A\x2D\x2D\x6D\x79\x62\x6F\x75\x6E\x64\x61\x72\x79", "video/mjpeg"}, // MJPEG
+}
+
+// TIFF based RAW formats, the header alone doesn't tell them apart so the extension does
+var rawExtensions = map[string]string{
+	".cr2": "image/x-canon-cr2",
+	".arw": "image/x-sony-arw",
+	".orf": "image/x-olympus-orf",
+	".dng": "image/x-adobe-dng",
+}
+
+var riffFormTypes = map[string]string{
+	"WEBP": "image/webp",      // WEBP
+	"AVI ": "video/x-msvideo", // AVI
+	"WAVE": "audio/wav",       // WAV
+}
+
+// ISO media brands at offset 8, after the box size and ftyp
+var ftypBrands = map[string]string{
+	"avif": "image/avif", // AVIF still
+	"avis": "image/avif", // AVIF sequence
+}
+
+func init() {
+	// lower case keys with a leading dot so IgnoreByExtension is a single lookup
+	normalized := make(map[string]string, len(skipExtensions))
+	for ext, name := range skipExtensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		normalized[ext] = name
+	}
+	skipExtensions = normalized
+
+	sort.SliceStable(imageSignatures, func(i, j int) bool {
+		return len(imageSignatures[i].magic) > len(imageSignatures[j].magic)
+	})
 }
 
 func NewFileSystem(basePath string) (*FileSystem, error) {
 	_, err := os.Stat(basePath)
 	if os.IsNotExist(err) {
-		log.Error().Err(err).Str("photoz", "filesystem").Str("file", basePath).Msg("does not exist")
 		return nil, err
 	}
-	return &FileSystem{BasePath: basePath}, nil
+	return &FileSystem{BasePath: basePath, HashBufferSize: defaultHashBufferSize, CopyBufferSize: defaultCopyBufferSize, FilePerm: defaultFilePerm, DirPerm: defaultDirPerm, Retries: defaultRetries, IgnoreNames: DefaultIgnoreNames}, nil
 }
 
+// IgnoreByName matches the base name against IgnoreNames, the rule that matched is returned for the log
 func (x *FileSystem) IgnoreByName(filePath string) (bool, string) {
 	name := filepath.Base(filePath)
-	// Apple metadata files which appear to be good image files, but aren't
-	if strings.HasPrefix(name, "._") {
+	if name == IgnoreFileName {
 		return true, name
 	}
+	for _, pattern := range x.IgnoreNames {
+		if match, _ := filepath.Match(pattern, name); match {
+			return true, pattern
+		}
+	}
 	return false, ""
 }
 
 func (x *FileSystem) IgnoreByExtension(filePath string) (bool, string) {
-	suffix := filepath.Ext(filePath)
-	for ext, name := range skipExtensions {
+	name, found := skipExtensions[strings.ToLower(filepath.Ext(filePath))]
+	return found, name
+}
 
-		if strings.EqualFold(suffix, ext) {
-			return true, name
-		}
-	}
-	return false, ""
+// ErrUnreadable wraps failures reading a file's content (ie. a bad sector), as opposed to it not being an image
+var ErrUnreadable = errors.New("unreadable file")
+
+func unreadable(err error) error {
+	return fmt.Errorf("%w: %w", ErrUnreadable, err)
 }
 
 func (x *FileSystem) IsImage(filePath string) (bool, string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return false, "", err
+		return false, "", unreadable(err)
 	}
 	defer file.Close()
 
-	buffer := make([]byte, 32)
-	_, err = io.ReadFull(file, buffer)
+	// DetectContentType looks at up to 512 bytes
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(file, buffer)
 	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-		return false, "", err
+		return false, "", unreadable(err)
+	}
+
+	// RIFF containers share a prefix, the form type at offset 8 says what's inside
+	if bytes.HasPrefix(buffer, []byte("RIFF")) {
+		mime, found := riffFormTypes[string(buffer[8:12])]
+		if !found || IsMedia(mime) {
+			return false, mime, nil
+		}
+		return true, mime, nil
+	}
+
+	if n >= 12 && string(buffer[4:8]) == "ftyp" {
+		if mime, found := ftypBrands[string(buffer[8:12])]; found {
+			return true, mime, nil
+		}
 	}
 
-	for magic, mime := range imageSignatures {
-		if bytes.HasPrefix(buffer, []byte(magic)) {
-			// HACK ALERT:  the PNG and NEF files share the same magic number GRRRR...
-			if mime == "image/png" {
-				suffix := filepath.Ext(filePath)
-				isNEF := strings.EqualFold(suffix, ".NEF")
+	for _, sig := range imageSignatures {
+		mime := sig.mime
+		if bytes.HasPrefix(buffer, []byte(sig.magic)) {
+			// RAW formats are TIFF containers, the extension or the Nikon maker note tell them apart
+			if raw, found := rawExtensions[strings.ToLower(filepath.Ext(filePath))]; found && mime == "image/tiff" {
+				mime = raw
+			} else if mime == "image/tiff" {
+				isNEF, err := x.hasNikonMakerNote(file)
+				if err != nil {
+					return false, "", unreadable(err)
+				}
 				if isNEF {
 					mime = "image/nef"
 				}
 			}
 
-			return true, mime, nil
+			return !IsMedia(mime), mime, nil
 		}
 	}
 
+	// best effort for formats the signatures above don't cover
+	mime := strings.Split(http.DetectContentType(buffer[:n]), ";")[0]
+	if strings.HasPrefix(mime, "image/") || strings.HasPrefix(mime, "video/") {
+		return !IsMedia(mime), mime, nil
+	}
+
 	return false, "", nil
 }
 
-func (x *FileSystem) CalculateMD5(filePath string) (string, error) {
+// IsMedia reports audio and video mime types, IsImage detects them but they are only ingested on request
+func IsMedia(mime string) bool {
+	return strings.HasPrefix(mime, "audio/") || strings.HasPrefix(mime, "video/")
+}
+
+// how far into a TIFF to look for the maker note, it lives in the EXIF sub-IFD near the start
+const makerNoteSearchBytes = 256 * 1024
+
+func (x *FileSystem) hasNikonMakerNote(file *os.File) (bool, error) {
+	header := make([]byte, makerNoteSearchBytes)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return bytes.Contains(header[:n], []byte("Nikon\x00")), nil
+}
+
+// contextReader stops a long read once the context is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (x *contextReader) Read(p []byte) (int, error) {
+	if err := x.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return x.r.Read(p)
+}
+
+// HashAlgo names the digest HashReader computes
+type HashAlgo string
+
+const (
+	HashMD5    HashAlgo = "md5"
+	HashSHA1   HashAlgo = "sha1"
+	HashSHA256 HashAlgo = "sha256"
+)
+
+func (x HashAlgo) newHash() (hash.Hash, error) {
+	switch x {
+	case HashMD5, "":
+		return md5.New(), nil
+	case HashSHA1:
+		return sha1.New(), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	}
+	return nil, errors.New("unknown hash algorithm " + string(x))
+}
+
+// HashReader digests everything r returns, hex encoded
+func (x *FileSystem) HashReader(r io.Reader, algo HashAlgo) (string, error) {
+	hash, err := algo.newHash()
+	if err != nil {
+		return "", err
+	}
+
+	bufferSize := x.HashBufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultHashBufferSize
+	}
+	if _, err := io.Copy(hash, bufio.NewReaderSize(r, bufferSize)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (x *FileSystem) CalculateMD5(ctx context.Context, filePath string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Error().Err(err).Str("photoz", "md5").Msg("file open failed")
+		x.logger().Error().Err(err).Str("photoz", "md5").Msg("file open failed")
 		return "", err
 	}
 	defer file.Close()
 
-	hash := md5.New()
+	sum, err := x.HashReader(&contextReader{ctx: ctx, r: file}, HashMD5)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", err
+		}
+		x.logger().Error().Err(err).Str("photoz", "md5").Msg("copy bytes failed")
+		return "", unreadable(err)
+	}
+	return sum, nil
+}
 
-	if _, err := io.Copy(hash, file); err != nil {
-		log.Error().Err(err).Str("photoz", "md5").Msg("copy bytes failed")
+// PrefixMD5 hashes the first n bytes, all of them when the file is shorter
+func (x *FileSystem) PrefixMD5(ctx context.Context, filePath string, n int64) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
 		return "", err
 	}
+	defer file.Close()
+
+	sum, err := x.HashReader(io.LimitReader(&contextReader{ctx: ctx, r: file}, n), HashMD5)
+	if err != nil && ctx.Err() == nil {
+		return "", unreadable(err)
+	}
+	return sum, err
+}
 
-	hashInBytes := hash.Sum(nil)
-	return hex.EncodeToString(hashInBytes), nil
+// CopyFile retries transient failures (ie. a flaky network share) with exponential backoff
+func (x *FileSystem) CopyFile(ctx context.Context, inFile, outFile string) error {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := x.copyFile(ctx, inFile, outFile)
+		if err == nil || attempt >= x.Retries || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		x.logger().Warn().Err(err).Str("component", "filesystem").Str("file", inFile).Int("attempt", attempt+1).Str("delay", delay.String()).Msg("copy retry")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
 }
 
-func (x *FileSystem) CopyFile(inFile, outFile string) error {
+// isTransient is true for I/O errors worth retrying, missing files and permissions are not
+func isTransient(err error) bool {
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ETIMEDOUT) || errors.Is(err, syscall.EAGAIN)
+}
+
+func (x *FileSystem) copyFile(ctx context.Context, inFile, outFile string) error {
 	src, err := os.Open(inFile)
 	if err != nil {
-		log.Error().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("open")
+		x.logger().Error().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("open")
 		return err
 	}
 	defer src.Close()
 
 	dst, err := os.Create(outFile)
 	if err != nil {
-		log.Error().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("create")
+		x.logger().Error().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("create")
 		return err
 	}
 	defer dst.Close()
 
-	written, err := io.Copy(dst, src)
+	bufferSize := x.CopyBufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultCopyBufferSize
+	}
+	// hide os.File's ReadFrom, it would copy through its own 32KB buffer instead of this one
+	written, err := io.CopyBuffer(struct{ io.Writer }{dst}, &contextReader{ctx: ctx, r: src}, make([]byte, bufferSize))
 	if err != nil || written == 0 {
-		log.Error().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("copy")
+		x.logger().Error().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("copy")
+		if IsDiskFull(err) || ctx.Err() != nil {
+			// don't leave a truncated original behind
+			dst.Close()
+			os.Remove(outFile)
+		}
 		if err == nil {
 			err = errors.New("no bytes copied")
 		}
 		return err
 	}
 
-	return x.Chmod(outFile, 0644)
+	perm := x.FilePerm
+	if perm == 0 {
+		perm = defaultFilePerm
+	}
+	return x.Chmod(outFile, perm)
+}
+
+// LinkFile places inFile at outFile by copying, hard linking or symlinking it.
+func (x *FileSystem) LinkFile(ctx context.Context, inFile, outFile string, mode LinkMode) error {
+	switch mode {
+	case LinkHard:
+		err := os.Link(inFile, outFile)
+		if errors.Is(err, syscall.EXDEV) {
+			x.logger().Warn().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("hard link across devices, copying instead")
+			return x.CopyFile(ctx, inFile, outFile)
+		}
+		if err != nil {
+			x.logger().Error().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("link")
+		}
+		return err
+	case LinkSoft:
+		// relative targets would resolve against the output directory
+		target, err := filepath.Abs(inFile)
+		if err != nil {
+			return err
+		}
+		err = os.Symlink(target, outFile)
+		if err != nil {
+			x.logger().Error().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("symlink")
+		}
+		return err
+	case LinkMove:
+		err := os.Rename(inFile, outFile)
+		if err != nil {
+			x.logger().Error().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("rename")
+		}
+		return err
+	default:
+		return x.CopyFile(ctx, inFile, outFile)
+	}
+}
+
+// HasCopy reports whether outFile already holds exactly these bytes, size first so most misses cost a stat
+func (x *FileSystem) HasCopy(ctx context.Context, outFile string, size int64, md5 string) bool {
+	fi, err := os.Stat(outFile)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != size {
+		return false
+	}
+	outMD5, err := x.CalculateMD5(ctx, outFile)
+	return err == nil && outMD5 == md5
+}
+
+// Sidecar keeps the provenance the flat output naming discards
+type Sidecar struct {
+	Source           string `json:"source"`
+	MimeType         string `json:"mimetype"`
+	MD5              string `json:"md5"`
+	OriginalDateTime string `json:"originaldatetime"`
+}
+
+// SidecarFile names the sidecar for an output file
+func SidecarFile(outFile string) string {
+	return outFile + ".json"
+}
+
+func (x *FileSystem) WriteSidecar(outFile string, fi ImageFileInfo) error {
+	source, err := filepath.Abs(fi.FilePath)
+	if err != nil {
+		source = fi.FilePath
+	}
+	data, err := json.MarshalIndent(Sidecar{
+		Source:           source,
+		MimeType:         fi.MimeType,
+		MD5:              fi.MD5,
+		OriginalDateTime: fi.OriginalDateTime,
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+	perm := x.FilePerm
+	if perm == 0 {
+		perm = defaultFilePerm
+	}
+	err = os.WriteFile(SidecarFile(outFile), data, perm)
+	if err != nil {
+		x.logger().Error().Err(err).Str("component", "filesystem").Str("file", SidecarFile(outFile)).Msg("sidecar")
+	}
+	return err
+}
+
+// FindAAE looks for the Apple edit sidecar sharing the photo's basename stem (ie. IMG_1234.AAE)
+func (x *FileSystem) FindAAE(filePath string) (string, bool) {
+	stem := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	for _, ext := range []string{".AAE", ".aae"} {
+		if fi, err := os.Stat(stem + ext); err == nil && fi.Mode().IsRegular() {
+			return stem + ext, true
+		}
+	}
+	return "", false
+}
+
+// FindLivePhotoPartner looks for the motion half of an iPhone Live Photo, the MOV sharing the photo's stem
+func (x *FileSystem) FindLivePhotoPartner(filePath string) (string, bool) {
+	stem := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	for _, ext := range []string{".MOV", ".mov"} {
+		if fi, err := os.Stat(stem + ext); err == nil && fi.Mode().IsRegular() {
+			return stem + ext, true
+		}
+	}
+	return "", false
+}
+
+// IsDiskFull reports whether err was caused by the output device running out of space.
+func IsDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// ParsePerm reads an octal permission string (ie. 0644)
+func ParsePerm(perm string) (fs.FileMode, error) {
+	mode, err := strconv.ParseUint(perm, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if mode > 0777 {
+		return 0, errors.New("permission out of range " + perm)
+	}
+	return fs.FileMode(mode), nil
+}
+
+func (x *FileSystem) MkdirAll(dir string) error {
+	perm := x.DirPerm
+	if perm == 0 {
+		perm = defaultDirPerm
+	}
+	err := os.MkdirAll(dir, perm)
+	if err != nil {
+		x.logger().Error().Err(err).Str("component", "filesystem").Str("dir", dir).Msg("mkdir")
+	}
+	return err
 }
 
 func (x *FileSystem) DeleteFile(inFile string) error {
 	err := os.Remove(inFile)
 	if err != nil {
-		log.Error().Err(err).Str("component", "filesystem").Str("file", inFile).Msg("delete")
+		// a missing file is the caller's call to make
+		if !os.IsNotExist(err) {
+			x.logger().Error().Err(err).Str("component", "filesystem").Str("file", inFile).Msg("delete")
+		}
 		return err
 	}
 	return nil
 }
 
+func (x *FileSystem) Walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, fn)
+}
+
+func (x *FileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (x *FileSystem) EvalSymlinks(path string) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
+
+// Open and OpenFile return a nil interface on error, not a nil *os.File
+func (x *FileSystem) Open(name string) (io.ReadCloser, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (x *FileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (x *FileSystem) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (x *FileSystem) OpenFile(name string, flag int, perm fs.FileMode) (io.WriteCloser, error) {
+	file, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (x *FileSystem) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
 func (x *FileSystem) Chmod(inFile string, mode fs.FileMode) error {
-	err := os.Chmod(inFile, 0644)
+	err := os.Chmod(inFile, mode)
 	if err != nil {
-		log.Error().Err(err).Str("component", "filesystem").Str("file", inFile).Msg("chmod")
+		x.logger().Error().Err(err).Str("component", "filesystem").Str("file", inFile).Msg("chmod")
 		return err
 	}
 	return nil
@@ -0,0 +1,71 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes data to name in a fresh temp dir
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestIsImageRIFF(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    string
+		isImage bool
+		mime    string
+	}{
+		{"photo.webp", "WEBP", true, "image/webp"},
+		{"clip.avi", "AVI ", false, "video/x-msvideo"},
+		{"sound.wav", "WAVE", false, "audio/wav"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := append([]byte("RIFF\x24\x00\x00\x00"), test.form...)
+			isImage, mime, err := (&FileSystem{}).IsImage(writeFile(t, test.name, append(header, make([]byte, 32)...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isImage != test.isImage || mime != test.mime {
+				t.Fatalf("got %v %s, want %v %s", isImage, mime, test.isImage, test.mime)
+			}
+		})
+	}
+}
+
+func TestIsImageNEF(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tests := []struct {
+		name string
+		data []byte
+		mime string
+	}{
+		{"photo.nef", append(append([]byte{}, tiff...), "....Nikon\x00\x02\x10\x00\x00"...), "image/nef"},
+		// no extension needed, the maker note decides
+		{"photo", append(append([]byte{}, tiff...), "....Nikon\x00\x02\x10\x00\x00"...), "image/nef"},
+		{"scan.tif", tiff, "image/tiff"},
+		// the content wins over the extension
+		{"renamed.NEF", png, "image/png"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isImage, mime, err := (&FileSystem{}).IsImage(writeFile(t, test.name, append(test.data, make([]byte, 32)...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isImage || mime != test.mime {
+				t.Fatalf("got %v %s, want an image %s", isImage, mime, test.mime)
+			}
+		})
+	}
+}
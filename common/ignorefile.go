@@ -0,0 +1,76 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// IgnoreFileName holds per directory globs, like .gitignore, that apply to everything below it
+const IgnoreFileName = ".photozignore"
+
+type ignoreRule struct {
+	// directory holding the .photozignore, patterns match paths relative to it
+	base    string
+	pattern string
+}
+
+// readIgnoreFile returns one pattern per line, blank lines and # comments are skipped
+func readIgnoreFile(fs IFileSystem, fileName string, logger Logger) ([]string, error) {
+	file, err := fs.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	patterns := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !doublestar.ValidatePattern(line) {
+			logger.Warn().Str("photoz", "ignore").Str("file", fileName).Str("pattern", line).Msg("invalid pattern skipped")
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// enterDir records the rules for dir, its parent's plus any from its own .photozignore
+func (x *Processor) enterDir(walkPath, dir string) {
+	inherited := x.ignoreRules[filepath.Dir(dir)]
+	patterns, err := readIgnoreFile(x.fs, filepath.Join(walkPath, IgnoreFileName), x.logger)
+	if err != nil && !os.IsNotExist(err) {
+		x.logger.Warn().Err(err).Str("photoz", "ignore").Str("file", dir).Msg("ignore file unreadable")
+	}
+	if len(patterns) == 0 {
+		x.ignoreRules[dir] = inherited
+		return
+	}
+	rules := append(make([]ignoreRule, 0, len(inherited)+len(patterns)), inherited...)
+	for _, pattern := range patterns {
+		rules = append(rules, ignoreRule{base: dir, pattern: pattern})
+	}
+	x.ignoreRules[dir] = rules
+}
+
+// ignored checks filePath against the rules of the directory it sits in
+func (x *Processor) ignored(filePath string) bool {
+	for _, rule := range x.ignoreRules[filepath.Dir(filePath)] {
+		rel, err := filepath.Rel(rule.base, filePath)
+		if err != nil {
+			continue
+		}
+		if match, _ := doublestar.Match(rule.pattern, filepath.ToSlash(rel)); match {
+			return true
+		}
+	}
+	return false
+}
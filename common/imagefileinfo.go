@@ -9,17 +9,56 @@ import (
 	"time"
 
 	"github.com/dsoprea/go-exif/v3"
-	"github.com/osintami/sloan/log"
+	"golang.org/x/text/unicode/norm"
 )
 
 type ImageFileInfo struct {
-	FilePath         string `json:"filepath"`
-	MimeType         string `json:"mimetype"`
-	MD5              string `json:"md5"`
-	FileName         string `json:"filename"`
+	FilePath string `json:"filepath"`
+	MimeType string `json:"mimetype"`
+	MD5      string `json:"md5"`
+	FileName string `json:"filename"`
+	// directory relative to the output root, empty for the top level
+	OutDir           string `json:"outdir"`
 	OriginalDateTime string `json:"originaldatetime"`
 	Duplicates       int32  `json:"duplicates"`
+	// source paths that collapsed into this original
+	DuplicatePaths []string `json:"duplicatepaths,omitempty"`
+	// source path of the MOV half when this photo is a Live Photo
+	LivePhotoPartner string `json:"livephotopartner,omitempty"`
 	HasExif          bool   `json:"hasexif"`
+	// why the EXIF block could not be parsed, empty when it was fine or simply absent
+	ExifError string `json:"exiferror,omitempty"`
+	// EXIF orientation 1-8, 1 is upright and zero is unknown
+	Orientation int `json:"orientation,omitempty"`
+	// pixel dimensions, zero when they couldn't be read
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// md5 of the decoded pixels, set by -pixel-hash
+	PixelHash string `json:"pixelhash,omitempty"`
+	// md5 of the first HeadHashBytes, set by -partial-dupes to pair truncated copies with the full file
+	HeadHash string `json:"headhash,omitempty"`
+	// the extension says another format than the content, ie. a png named .jpg
+	ExtensionMismatch bool `json:"extensionmismatch,omitempty"`
+	// format the output was re-encoded to, empty for a byte copy
+	ConvertedTo string `json:"convertedto,omitempty"`
+	// set by -validate-decode once a jpeg, png or gif fully decoded
+	DecodeOK bool `json:"decodeok"`
+	// recorded by -pass discover and not placed in the output yet
+	Pending  bool  `json:"pending,omitempty"`
+	Verified bool  `json:"verified"`
+	Size     int64 `json:"size"`
+	ModTime  int64 `json:"modtime"`
+	// where EXIF trouble is logged, never stored
+	logTo Logger
+}
+
+// SetLogger sends the EXIF warnings to logger instead of the default
+func (x *ImageFileInfo) SetLogger(logger Logger) {
+	x.logTo = logger
+}
+
+func (x *ImageFileInfo) logger() Logger {
+	return loggerOr(x.logTo)
 }
 
 func NewImageFileInfo(filePath, mimeType, md5 string) ImageFileInfo {
@@ -30,52 +69,141 @@ func NewImageFileInfo(filePath, mimeType, md5 string) ImageFileInfo {
 	return ifi
 }
 
-func (x *ImageFileInfo) GetJpegCreatedAt() error {
+// format names accepted by -exif and the mime types they cover
+var exifFormats = map[string][]string{
+	"jpeg": {"image/jpeg"},
+	"jpg":  {"image/jpeg"},
+	"tiff": {"image/tiff"},
+	"heic": {"image/heic"},
+	"webp": {"image/webp"},
+	"avif": {"image/avif"},
+	"nef":  {"image/nef"},
+	"cr2":  {"image/x-canon-cr2"},
+	"arw":  {"image/x-sony-arw"},
+	"orf":  {"image/x-olympus-orf"},
+	"dng":  {"image/x-adobe-dng"},
+	"raw":  {"image/nef", "image/x-canon-cr2", "image/x-sony-arw", "image/x-olympus-orf", "image/x-adobe-dng"},
+}
+
+// ParseExifFormats reads a list like jpeg,heic into the mime types to parse EXIF for,
+// an empty list is nil and means every format, none parses nothing
+func ParseExifFormats(formats string) (map[string]bool, error) {
+	if strings.TrimSpace(formats) == "" {
+		return nil, nil
+	}
+	out := make(map[string]bool)
+	for _, format := range strings.Split(strings.ToLower(formats), ",") {
+		format = strings.TrimSpace(format)
+		if format == "" || format == "none" {
+			continue
+		}
+		mimes, found := exifFormats[format]
+		if !found {
+			return nil, fmt.Errorf("unknown exif format %q", format)
+		}
+		for _, mime := range mimes {
+			out[mime] = true
+		}
+	}
+	return out, nil
+}
+
+// ErrExifCorrupt marks EXIF that is present but fails to parse, as opposed to missing
+var ErrExifCorrupt = errors.New("exif data corrupt")
+
+// recoverExif turns a go-exif panic (ie. on a malformed maker note) into an ErrExifCorrupt error,
+// one bad file must not take down the whole scan. Deferred directly, recover only works there.
+func recoverExif(logger Logger, filePath string, err *error) {
+	if r := recover(); r != nil {
+		logger.Error().Str("photoz", "exif").Str("file", filePath).Str("panic", fmt.Sprint(r)).Msg("exif parser panic")
+		*err = fmt.Errorf("%w: parser panic: %v", ErrExifCorrupt, r)
+	}
+}
+
+// DumpExif returns every EXIF tag in the file, handy when a photo lands undated
+func (x *ImageFileInfo) DumpExif() (tags []exif.ExifTag, err error) {
+	defer recoverExif(x.logger(), x.FilePath, &err)
+
 	// extract the EXIF data from a file
-	rawExif, err := exif.SearchFileAndExtractExif(x.FilePath)
+	rawExif, err := readRawExif(x.FilePath)
 	if err != nil {
-		log.Warn().Str("path", x.FilePath).Msg("exif data missing")
-		return err
+		x.logger().Warn().Str("path", x.FilePath).Msg("exif data missing")
+		return nil, err
 	}
 
 	// parse the raw EXIF data into a structured format
-	tags, _, err := exif.GetFlatExifData(rawExif, nil)
+	tags, _, err = exif.GetFlatExifData(rawExif, nil)
+	if err != nil {
+		x.logger().Error().Err(err).Str("photoz", "exif").Str("file", x.FilePath).Msg("exif data corrupt")
+		return nil, fmt.Errorf("%w: %w", ErrExifCorrupt, err)
+	}
+	return tags, nil
+}
+
+func (x *ImageFileInfo) GetJpegCreatedAt() (err error) {
+	defer recoverExif(x.logger(), x.FilePath, &err)
+
+	tags, err := x.DumpExif()
 	if err != nil {
-		log.Error().Err(err).Str("photoz", "exif").Str("file", x.FilePath).Msg("exif data corrupt")
 		return err
 	}
 
-	if false {
-		for _, tag := range tags {
-			fmt.Printf("Tag: %s, Value: %v\n", tag.TagName, tag.Value)
+	// IFD0 orientation, IFD1 belongs to the thumbnail. The dimensions come along so they
+	// don't cost another exif read.
+	for _, tag := range tags {
+		switch {
+		case tag.TagName == "Orientation" && tag.IfdPath == "IFD":
+			x.Orientation = exifInt(tag.Value)
+		case tag.TagName == "PixelXDimension":
+			x.Width = exifInt(tag.Value)
+		case tag.TagName == "PixelYDimension":
+			x.Height = exifInt(tag.Value)
 		}
 	}
 
 	originalTime := ""
+	best := -1
+	tiff := x.IsTIFF()
+	var badTag error
 
 	for _, tag := range tags {
-		// JPEG and NEF tag names for original date
-		if tag.TagName == "DateTimeOriginal" || tag.TagName == "Create Date" {
-			exifTime := tag.Value.(string)
-			// some older JPEGs from my old Nikon 950 camera has junk at the end of the date, not sure why
-			exifTime = strings.Replace(exifTime, "\x00", "", 1)
-
-			if exifTime == "0000:00:00 00:00:00" {
-				log.Warn().Str("path", x.FilePath).Msg("exif data present but empty")
-				return errors.New("exif tag empty")
+		rank := dateRank(tag, tiff)
+		if rank < 0 || best >= 0 && rank > best {
+			continue
+		}
+		exifTime, ok := exifString(tag.Value)
+		if !ok {
+			// a malformed tag from some cameras, another date tag may still be fine
+			x.logger().Warn().Str("photoz", "exif").Str("file", x.FilePath).Str("tag", tag.TagName).Str("type", fmt.Sprintf("%T", tag.Value)).Msg("date tag not a string")
+			badTag = fmt.Errorf("%w: %s is %T", ErrExifCorrupt, tag.TagName, tag.Value)
+			continue
+		}
+		// some older JPEGs from my old Nikon 950 camera has junk at the end of the date, not sure why
+		exifTime = strings.Replace(exifTime, "\x00", "", 1)
+
+		if exifTime == "0000:00:00 00:00:00" {
+			// an empty last modified date is only a missing fallback
+			if rank == dateRankModified {
+				continue
 			}
-			originalTime = fmt.Sprintf("%v", exifTime)
+			x.logger().Warn().Str("path", x.FilePath).Msg("exif data present but empty")
+			return errors.New("exif tag empty")
 		}
+		originalTime = fmt.Sprintf("%v", exifTime)
+		best = rank
 	}
 
+	if originalTime == "" && badTag != nil {
+		return badTag
+	}
 	if originalTime == "" {
-		log.Warn().Str("path", x.FilePath).Msg("no exif error and no time tag found")
+		x.logger().Warn().Str("path", x.FilePath).Msg("no exif error and no time tag found")
 		return errors.New("empty exif data")
 	}
 
-	date, err := time.Parse("2006:01:02 15:04:05", originalTime)
+	date, err := parseExifDate(originalTime)
 	if err != nil {
-		log.Error().Err(err).Str("photoz", "exif").Str("file", x.FilePath).Msg("time parse")
+		x.logger().Error().Err(err).Str("photoz", "exif").Str("file", x.FilePath).Msg("time parse")
 		return err
 	}
 
@@ -84,25 +212,170 @@ func (x *ImageFileInfo) GetJpegCreatedAt() error {
 	return nil
 }
 
+const dateRankModified = 2
+
+// dateRank orders the tags that can hold the capture date, lower wins and -1 is not a date. TIFF
+// containers (NEF, DNG, scans) keep the capture date in the EXIF sub-IFD and the last edit in IFD0
+// DateTime, go-exif reads either byte order so only the IFD path matters here.
+func dateRank(tag exif.ExifTag, tiff bool) int {
+	switch {
+	case tag.TagName == "DateTimeOriginal" && tag.IfdPath == "IFD/Exif":
+		return 0
+	case tag.TagName == "DateTimeOriginal" || tag.TagName == "Create Date":
+		return 1
+	case tiff && tag.TagName == "DateTime" && tag.IfdPath == "IFD":
+		return dateRankModified
+	}
+	return -1
+}
+
+// some cameras (ie. older Panasonic and Samsung) write dots or hyphens instead of colons
+var exifDateLayouts = []string{
+	"2006:01:02 15:04:05",
+	"2006:01:02T15:04:05",
+	"2006:01:02 15:04",
+}
+
+func parseExifDate(value string) (time.Time, error) {
+	normalized := strings.NewReplacer(".", ":", "-", ":").Replace(strings.TrimSpace(value))
+	var err error
+	for _, layout := range exifDateLayouts {
+		var date time.Time
+		if date, err = time.Parse(layout, normalized); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, err
+}
+
 func (x *ImageFileInfo) SetFileName() {
 	if x.OriginalDateTime != "" {
-		x.FileName = x.OriginalDateTime + "_" + x.MD5 + "_" + filepath.Base(x.FilePath)
+		x.FileName = x.OriginalDateTime + "_" + x.MD5 + "_" + BaseName(x.FilePath)
 	} else {
-		x.FileName = "0000000000" + "_" + x.MD5 + "_" + filepath.Base(x.FilePath)
+		x.FileName = "0000000000" + "_" + x.MD5 + "_" + BaseName(x.FilePath)
 	}
 }
 
+// canonical extensions for -normalize-ext, anything else is only lower cased
+var extAliases = map[string]string{
+	".jpeg": ".jpg",
+	".jpe":  ".jpg",
+	".tif":  ".tiff",
+}
+
+// NormalizeExtension lower cases the output name's extension and maps aliases, ie. .JPEG to .jpg
+func (x *ImageFileInfo) NormalizeExtension() {
+	ext := filepath.Ext(x.FileName)
+	canonical := strings.ToLower(ext)
+	if alias, found := extAliases[canonical]; found {
+		canonical = alias
+	}
+	x.FileName = strings.TrimSuffix(x.FileName, ext) + canonical
+}
+
+// extensions each detected format goes by, the first is the one -fix-ext names it with
+var mimeExtensions = map[string][]string{
+	"image/jpeg":          {".jpg", ".jpeg", ".jpe", ".jfif"},
+	"image/png":           {".png"},
+	"image/gif":           {".gif"},
+	"image/bmp":           {".bmp"},
+	"image/webp":          {".webp"},
+	"image/avif":          {".avif"},
+	"image/heic":          {".heic", ".heif"},
+	"image/tiff":          {".tiff", ".tif"},
+	"image/nef":           {".nef"},
+	"image/x-canon-cr2":   {".cr2"},
+	"image/x-sony-arw":    {".arw"},
+	"image/x-olympus-orf": {".orf"},
+	"image/x-adobe-dng":   {".dng"},
+}
+
+func hasExtension(mime, ext string) bool {
+	for _, known := range mimeExtensions[mime] {
+		if ext == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtensionMismatch returns the extension the content calls for when filePath's contradicts it,
+// formats without a known extension never mismatch
+func ExtensionMismatch(filePath, mime string) (string, bool) {
+	extensions, found := mimeExtensions[mime]
+	if !found {
+		return "", false
+	}
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if hasExtension(mime, ext) {
+		return "", false
+	}
+	// a TIFF header alone can't tell a scan from a RAW, any TIFF based extension is believed
+	if mime == "image/tiff" || IsRAW(mime) {
+		for tiffMime := range mimeExtensions {
+			if (tiffMime == "image/tiff" || IsRAW(tiffMime)) && hasExtension(tiffMime, ext) {
+				return "", false
+			}
+		}
+	}
+	return extensions[0], true
+}
+
+// FixExtension swaps the output extension for the one the content calls for
+func (x *ImageFileInfo) FixExtension() {
+	if ext, mismatch := ExtensionMismatch(x.FileName, x.MimeType); mismatch {
+		x.FileName = strings.TrimSuffix(x.FileName, filepath.Ext(x.FileName)) + ext
+	}
+}
+
+// BaseName is the NFC normalized base name, macOS hands out NFD names so the same
+// accented name would otherwise produce two different output names
+func BaseName(filePath string) string {
+	return norm.NFC.String(filepath.Base(filePath))
+}
+
+// OutputPath is where the original lives relative to the output root
+func (x *ImageFileInfo) OutputPath() string {
+	return filepath.Join(x.OutDir, x.FileName)
+}
+
 func (x *ImageFileInfo) IsJPEG() bool {
 	return x.MimeType == "image/jpeg"
 }
 
 func (x *ImageFileInfo) IsNEF() bool {
-	suffix := filepath.Ext(x.FilePath)
-	isNEF := strings.EqualFold(suffix, ".NEF")
-	if isNEF {
-		x.MimeType = "image/nef"
+	return x.MimeType == "image/nef"
+}
+
+// IsRAW covers the TIFF based camera RAW formats, all of them carry EXIF like a JPEG
+func (x *ImageFileInfo) IsRAW() bool {
+	return IsRAW(x.MimeType)
+}
+
+func IsRAW(mime string) bool {
+	if mime == "image/nef" {
+		return true
 	}
-	return isNEF
+	for _, raw := range rawExtensions {
+		if mime == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTIFF covers plain TIFF and the RAW formats built on it
+func (x *ImageFileInfo) IsTIFF() bool {
+	return x.MimeType == "image/tiff" || x.IsRAW()
+}
+
+// IsWebP and IsAVIF are the modern formats that can carry an EXIF block
+func (x *ImageFileInfo) IsWebP() bool {
+	return x.MimeType == "image/webp"
+}
+
+func (x *ImageFileInfo) IsAVIF() bool {
+	return x.MimeType == "image/avif"
 }
 
 func (x *ImageFileInfo) IsHEIC() bool {
@@ -0,0 +1,104 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeJPEG writes a jpeg that is only an SOI and one APP1 segment holding payload
+func writeJPEG(t *testing.T, name string, payload []byte) string {
+	t.Helper()
+	size := len(payload) + 2
+	data := append([]byte{0xff, 0xd8, 0xff, 0xe1, byte(size >> 8), byte(size)}, payload...)
+	data = append(data, 0xff, 0xd9)
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestCorruptExifNoPanic(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"truncated tiff header", []byte("Exif\x00\x00II*\x00")},
+		{"ifd offset past the end", []byte("Exif\x00\x00II*\x00\xff\xff\xff\x7f")},
+		{"ifd entry count past the end", []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\xff\xff")},
+		{"garbage", []byte("Exif\x00\x00\x13\x37garbage garbage garbage")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("panic escaped: %v", r)
+				}
+			}()
+			fi := NewImageFileInfo(writeJPEG(t, "corrupt.jpg", test.payload), "image/jpeg", "md5")
+			if err := fi.GetJpegCreatedAt(); err == nil {
+				t.Fatal("corrupt exif parsed without an error")
+			}
+			if fi.OriginalDateTime != "" {
+				t.Fatalf("date %q from corrupt exif", fi.OriginalDateTime)
+			}
+			// formats Go can't decode take their dimensions from the same exif
+			if width, height, err := (&FileSystem{}).ImageDimensions(fi.FilePath, "image/heic"); err == nil {
+				t.Fatalf("dimensions %dx%d from corrupt exif", width, height)
+			}
+		})
+	}
+}
+
+func TestRecoverExif(t *testing.T) {
+	parse := func() (err error) {
+		defer recoverExif(DefaultLogger, "bad.jpg", &err)
+		panic("index out of range")
+	}
+	if err := parse(); !errors.Is(err, ErrExifCorrupt) {
+		t.Fatalf("got %v, want ErrExifCorrupt", err)
+	}
+}
+
+func TestParseExifDate(t *testing.T) {
+	want := time.Date(2019, 5, 6, 10, 11, 12, 0, time.UTC)
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"2019:05:06 10:11:12", true},
+		{"2019.05.06 10:11:12", true},
+		{"2019-05-06 10:11:12", true},
+		{"not a date", false},
+	}
+	for _, test := range tests {
+		date, err := parseExifDate(test.value)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%q parsed as %v", test.value, date)
+			}
+			continue
+		}
+		if err != nil || !date.Equal(want) {
+			t.Errorf("%q: got %v %v, want %v", test.value, date, err, want)
+		}
+	}
+}
+
+func TestSetFileNameNFC(t *testing.T) {
+	// café with a precomposed é, and with e plus a combining acute as macOS writes it
+	names := make(map[string]bool)
+	for _, filePath := range []string{"/photos/caf\u00e9.jpg", "/photos/cafe\u0301.jpg"} {
+		fi := NewImageFileInfo(filePath, "image/jpeg", "md5")
+		fi.OriginalDateTime = "1557137472"
+		fi.SetFileName()
+		names[fi.FileName] = true
+	}
+	if len(names) != 1 {
+		t.Fatalf("got %d output names %v, want 1", len(names), names)
+	}
+}
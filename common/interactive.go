@@ -0,0 +1,48 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// chooser decides whether a duplicate should replace the stored original
+type chooser func(stored, candidate ImageFileInfo) bool
+
+// IsTerminal reports whether f is a terminal rather than a pipe or file
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// promptChooser asks on the terminal which copy to keep, anything but 2 keeps the stored one
+func promptChooser(in io.Reader, out io.Writer, logger Logger) chooser {
+	reader := bufio.NewReader(in)
+	return func(stored, candidate ImageFileInfo) bool {
+		fmt.Fprintln(out, " DUPLICATE: ", stored.MD5)
+		fmt.Fprintf(out, "  [1] %s  %s (kept)\n", describeDate(stored), stored.FilePath)
+		fmt.Fprintf(out, "  [2] %s  %s\n", describeDate(candidate), candidate.FilePath)
+		fmt.Fprint(out, "keep which? [1/2] (default 1): ")
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			logger.Warn().Err(err).Str("photoz", "interactive").Msg("no answer, original kept")
+			return false
+		}
+		return strings.TrimSpace(answer) == "2"
+	}
+}
+
+func describeDate(fi ImageFileInfo) string {
+	date, dated := fi.CreatedAt()
+	switch {
+	case !dated:
+		return "undated            "
+	case fi.HasExif:
+		return date.Format("2006-01-02 15:04:05")
+	}
+	// dated by a Takeout sidecar
+	return date.Format("2006-01-02 15:04:05") + "*"
+}
@@ -0,0 +1,160 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Journal records each placed original as it happens so a run killed before the db persists
+// loses nothing. A line is the crc32 of its JSON then the JSON, a torn last line fails the check.
+type Journal struct {
+	path   string
+	fs     IFileSystem
+	mu     sync.Mutex
+	file   io.WriteCloser
+	sealed []string
+}
+
+type journalEntry struct {
+	Key  string        `json:"key"`
+	Item ImageFileInfo `json:"item"`
+}
+
+// JournalFile sits next to the db, photoz.db journals to photoz.db.journal
+func JournalFile(dbPath string) string {
+	return dbPath + ".journal"
+}
+
+// OpenJournal replays whatever an interrupted run left into db, persists it and starts an empty journal
+func OpenJournal(path string, db IFastCache, fs IFileSystem, logger Logger) (*Journal, error) {
+	logger = loggerOr(logger)
+	files := journalFiles(fs, path)
+	replayed := 0
+	for _, file := range files {
+		n, err := replayJournal(fs, file, db, logger)
+		if err != nil {
+			return nil, err
+		}
+		replayed += n
+	}
+	if replayed > 0 {
+		if err := db.Persist(); err != nil {
+			return nil, err
+		}
+		logger.Info().Str("photoz", "journal").Str("file", path).Int("total", replayed).Msg("journal replayed")
+	}
+	for _, file := range files {
+		fs.DeleteFile(file)
+	}
+
+	file, err := fs.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{path: path, fs: fs, file: file}, nil
+}
+
+// journalFiles are the sealed journals oldest first, then the live one
+func journalFiles(fs IFileSystem, path string) []string {
+	sealed, _ := fs.Glob(path + ".*")
+	sort.Strings(sealed)
+	if _, err := fs.Stat(path); err == nil {
+		sealed = append(sealed, path)
+	}
+	return sealed
+}
+
+func replayJournal(fs IFileSystem, path string, db IFastCache, logger Logger) (int, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	replayed := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		sum, data, found := strings.Cut(scanner.Text(), " ")
+		var entry journalEntry
+		if !found || sum != fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(data))) || json.Unmarshal([]byte(data), &entry) != nil {
+			// only the line being written when the run died can be torn
+			logger.Warn().Str("photoz", "journal").Str("file", path).Int("line", replayed+1).Msg("damaged journal entry, rest ignored")
+			break
+		}
+		db.Set(entry.Key, entry.Item, -1)
+		replayed++
+	}
+	return replayed, scanner.Err()
+}
+
+// Record appends one placed original, the write is unbuffered so a killed process keeps it
+func (x *Journal) Record(key string, fi ImageFileInfo) error {
+	data, err := json.Marshal(journalEntry{Key: key, Item: fi})
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	_, err = fmt.Fprintf(x.file, "%08x %s\n", crc32.ChecksumIEEE(data), data)
+	return err
+}
+
+// Seal moves the entries so far aside before the db persists, entries recorded during the
+// persist go to a fresh journal so Release never drops one the db may not have saved
+func (x *Journal) Seal() ([]string, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := x.file.Close(); err != nil {
+		return nil, err
+	}
+	sealed := fmt.Sprintf("%s.%d", x.path, time.Now().UnixNano())
+	renameErr := x.fs.Rename(x.path, sealed)
+	if renameErr == nil {
+		x.sealed = append(x.sealed, sealed)
+	}
+	file, err := x.fs.OpenFile(x.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	x.file = file
+	return append([]string(nil), x.sealed...), renameErr
+}
+
+// Release drops sealed journals once the db holding their entries persisted
+func (x *Journal) Release(sealed []string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, file := range sealed {
+		x.fs.DeleteFile(file)
+	}
+	x.sealed = x.sealed[len(sealed):]
+}
+
+// Close leaves the journal on disk for the next run to replay
+func (x *Journal) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.file.Close()
+}
+
+// Remove closes and deletes the journal after a clean finish
+func (x *Journal) Remove() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.file.Close()
+	for _, file := range x.sealed {
+		x.fs.DeleteFile(file)
+	}
+	x.sealed = nil
+	return x.fs.DeleteFile(x.path)
+}
@@ -0,0 +1,36 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"github.com/osintami/sloan/log"
+)
+
+// LogEvent is one structured line, sloan's own chain so its events pass straight through
+type LogEvent = log.ILogger
+
+// Logger is where photoz logs to, the global sloan log unless an embedding program
+// injects its own (ie. to capture the lines in its tests)
+type Logger interface {
+	Debug() LogEvent
+	Info() LogEvent
+	Warn() LogEvent
+	Error() LogEvent
+}
+
+// DefaultLogger forwards to the global sloan log
+var DefaultLogger Logger = sloanLogger{}
+
+type sloanLogger struct{}
+
+func (sloanLogger) Debug() LogEvent { return log.Debug() }
+func (sloanLogger) Info() LogEvent  { return log.Info() }
+func (sloanLogger) Warn() LogEvent  { return log.Warn() }
+func (sloanLogger) Error() LogEvent { return log.Error() }
+
+// loggerOr is logger, or the default when none was injected
+func loggerOr(logger Logger) Logger {
+	if logger == nil {
+		return DefaultLogger
+	}
+	return logger
+}
@@ -0,0 +1,56 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// HashManifest writes md5<tab>path for every image under root, no EXIF, copying or db
+func (x *FileSystem) HashManifest(ctx context.Context, root string, w io.Writer) (int, error) {
+	out := bufio.NewWriter(w)
+	count := 0
+	err := filepath.Walk(root, func(filePath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if fi.IsDir() {
+			if fi.Name() == "Thumbs" || fi.Name() == "resources" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignore, _ := x.IgnoreByName(filePath); ignore {
+			return nil
+		}
+		if ignore, _ := x.IgnoreByExtension(filePath); ignore {
+			return nil
+		}
+		isImg, _, err := x.IsImage(filePath)
+		if err != nil || !isImg {
+			return nil
+		}
+		md5, err := x.CalculateMD5(ctx, filePath)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			x.logger().Error().Err(err).Str("photoz", "manifest").Str("file", filePath).Msg("md5 failure")
+			return nil
+		}
+		count += 1
+		_, err = fmt.Fprintf(out, "%s\t%s\n", md5, filePath)
+		return err
+	})
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	return count, err
+}
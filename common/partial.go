@@ -0,0 +1,80 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// HeadHashBytes is how much of a file -partial-dupes hashes, files no larger are never paired
+const HeadHashBytes = 64 * 1024
+
+// PartialDuplicate is a truncated copy, ie. from a failed backup, and the complete file it is a prefix of
+type PartialDuplicate struct {
+	Complete     string `json:"complete"`
+	CompleteSize int64  `json:"completesize"`
+	Partial      string `json:"partial"`
+	PartialSize  int64  `json:"partialsize"`
+}
+
+// PartialDuplicates pairs originals sharing a head hash where the smaller one is a strict byte
+// prefix of the largest. Only files with a matching head are read, the source or else the output copy.
+func PartialDuplicates(ctx context.Context, db IFastCache, fs IFileSystem, outPath string, logger Logger) []PartialDuplicate {
+	logger = loggerOr(logger)
+	byHead := make(map[string][]ImageFileInfo)
+	db.ForEach(func(item ImageFileInfo) {
+		if item.HeadHash != "" {
+			byHead[item.HeadHash] = append(byHead[item.HeadHash], item)
+		}
+	})
+
+	pairs := make([]PartialDuplicate, 0)
+	for _, items := range byHead {
+		if len(items) < 2 || ctx.Err() != nil {
+			continue
+		}
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].Size > items[j].Size
+		})
+		complete := items[0]
+		completeFile := readablePath(complete, outPath)
+		if completeFile == "" {
+			continue
+		}
+		for _, item := range items[1:] {
+			if item.Size == complete.Size {
+				continue
+			}
+			prefix, err := fs.PrefixMD5(ctx, completeFile, item.Size)
+			if err != nil {
+				logger.Warn().Err(err).Str("photoz", "partial").Str("file", completeFile).Msg("prefix hash failed")
+				break
+			}
+			if prefix != item.MD5 {
+				continue
+			}
+			pairs = append(pairs, PartialDuplicate{
+				Complete:     complete.OutputPath(),
+				CompleteSize: complete.Size,
+				Partial:      item.OutputPath(),
+				PartialSize:  item.Size,
+			})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Partial < pairs[j].Partial
+	})
+	return pairs
+}
+
+// readablePath is the source when it still exists, otherwise the copy in the output
+func readablePath(item ImageFileInfo, outPath string) string {
+	for _, filePath := range []string{item.FilePath, filepath.Join(outPath, item.OutputPath())} {
+		if _, err := os.Stat(filePath); err == nil {
+			return filePath
+		}
+	}
+	return ""
+}
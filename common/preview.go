@@ -0,0 +1,217 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNoPreview = errors.New("no embedded jpeg preview")
+
+// previews bigger than this are a misread offset, not a jpeg
+const maxPreviewBytes = 64 * 1024 * 1024
+
+// TIFF tags that locate an embedded jpeg
+const (
+	tagSubfileType    = 0x00fe
+	tagCompression    = 0x0103
+	tagStripOffsets   = 0x0111
+	tagStripCounts    = 0x0117
+	tagSubIFDs        = 0x014a
+	tagJPEGOffset     = 0x0201
+	tagJPEGLength     = 0x0202
+	tagExifIFD        = 0x8769
+	compressionJPEG   = 6
+	compressionNewJPG = 7
+)
+
+// ExtractPreview returns the largest embedded jpeg of a TIFF based RAW (NEF, CR2, DNG, ARW, ORF),
+// found through the thumbnail and strip tags of IFD0, its chain and the sub IFDs
+func (x *FileSystem) ExtractPreview(filePath, mime string) ([]byte, error) {
+	if !IsRAW(mime) {
+		return nil, fmt.Errorf("%w: %s is not a raw format", ErrNoPreview, mime)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, unreadable(err)
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, unreadable(err)
+	}
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: not a tiff container", ErrNoPreview)
+	}
+	// 42 for TIFF, ORF writes its own magic in the same place
+	switch order.Uint16(header[2:4]) {
+	case 42, 0x4f52, 0x5352:
+	default:
+		return nil, fmt.Errorf("%w: not a tiff container", ErrNoPreview)
+	}
+
+	ifds := &tiffReader{r: file, order: order, seen: make(map[uint32]bool)}
+	ifds.walk(order.Uint32(header[4:8]), 0)
+
+	var best [2]uint32
+	for _, candidate := range ifds.jpegs {
+		if candidate[1] > best[1] && isViewableJPEG(file, candidate[0]) {
+			best = candidate
+		}
+	}
+	if best[1] == 0 {
+		return nil, ErrNoPreview
+	}
+	preview := make([]byte, best[1])
+	if _, err := file.ReadAt(preview, int64(best[0])); err != nil {
+		return nil, unreadable(err)
+	}
+	return preview, nil
+}
+
+// WritePreview saves an extracted preview with the same permissions as a copied original
+func (x *FileSystem) WritePreview(outFile string, preview []byte) error {
+	perm := x.FilePerm
+	if perm == 0 {
+		perm = defaultFilePerm
+	}
+	err := os.WriteFile(outFile, preview, perm)
+	if err != nil {
+		x.logger().Error().Err(err).Str("component", "filesystem").Str("file", outFile).Msg("preview")
+	}
+	return err
+}
+
+// PreviewFile is where the preview of a RAW output goes, next to it under the same stem
+func PreviewFile(outFile string) string {
+	return strings.TrimSuffix(outFile, filepath.Ext(outFile)) + ".preview.jpg"
+}
+
+// tiffReader collects offset and length of every jpeg an IFD tree points at
+type tiffReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+	// a damaged file can loop its IFD chain
+	seen  map[uint32]bool
+	jpegs [][2]uint32
+}
+
+// walk reads the IFD at offset, its sub IFDs and the rest of its chain
+func (x *tiffReader) walk(offset uint32, depth int) {
+	for offset != 0 && !x.seen[offset] && depth < 4 && len(x.seen) < 64 {
+		x.seen[offset] = true
+		count := make([]byte, 2)
+		if _, err := x.r.ReadAt(count, int64(offset)); err != nil {
+			return
+		}
+		n := int(x.order.Uint16(count))
+		entries := make([]byte, n*12+4)
+		if _, err := x.r.ReadAt(entries, int64(offset)+2); err != nil {
+			return
+		}
+
+		tags := make(map[uint16][]uint32)
+		for i := 0; i < n; i++ {
+			entry := entries[i*12 : i*12+12]
+			tags[x.order.Uint16(entry[:2])] = x.values(entry)
+		}
+		if jpegOffset, jpegLength := first(tags[tagJPEGOffset]), first(tags[tagJPEGLength]); jpegOffset > 0 && jpegLength > 0 {
+			x.add(jpegOffset, jpegLength)
+		}
+		// a single strip jpeg, the raw data itself is reduced resolution 0 and split in many strips
+		compression := first(tags[tagCompression])
+		strips, counts := tags[tagStripOffsets], tags[tagStripCounts]
+		if (compression == compressionJPEG || compression == compressionNewJPG) && len(strips) == 1 && len(counts) == 1 {
+			x.add(strips[0], counts[0])
+		}
+		for _, sub := range tags[tagSubIFDs] {
+			x.walk(sub, depth+1)
+		}
+		if exifIFD := first(tags[tagExifIFD]); exifIFD != 0 {
+			x.walk(exifIFD, depth+1)
+		}
+		offset = x.order.Uint32(entries[n*12:])
+	}
+}
+
+func (x *tiffReader) add(offset, length uint32) {
+	if length <= maxPreviewBytes {
+		x.jpegs = append(x.jpegs, [2]uint32{offset, length})
+	}
+}
+
+// values reads SHORT and LONG entries, inline when they fit in four bytes
+func (x *tiffReader) values(entry []byte) []uint32 {
+	kind, count := x.order.Uint16(entry[2:4]), x.order.Uint32(entry[4:8])
+	size := uint32(0)
+	switch kind {
+	case 3:
+		size = 2
+	case 4, 13:
+		size = 4
+	default:
+		return nil
+	}
+	if count == 0 || count > 1024 {
+		return nil
+	}
+	data := entry[8:12]
+	if size*count > 4 {
+		data = make([]byte, size*count)
+		if _, err := x.r.ReadAt(data, int64(x.order.Uint32(entry[8:12]))); err != nil {
+			return nil
+		}
+	}
+	out := make([]uint32, count)
+	for i := range out {
+		if size == 2 {
+			out[i] = uint32(x.order.Uint16(data[i*2:]))
+		} else {
+			out[i] = x.order.Uint32(data[i*4:])
+		}
+	}
+	return out
+}
+
+func first(values []uint32) uint32 {
+	if len(values) == 0 {
+		return 0
+	}
+	return values[0]
+}
+
+// isViewableJPEG is true for a baseline or progressive jpeg, CR2 and DNG keep the raw data itself
+// as lossless jpeg which starts the same way but no viewer decodes
+func isViewableJPEG(r io.ReaderAt, offset uint32) bool {
+	pos := int64(offset)
+	marker := make([]byte, 4)
+	if _, err := r.ReadAt(marker[:2], pos); err != nil || marker[0] != 0xff || marker[1] != 0xd8 {
+		return false
+	}
+	pos += 2
+	for i := 0; i < 64; i++ {
+		if _, err := r.ReadAt(marker, pos); err != nil || marker[0] != 0xff {
+			return false
+		}
+		switch marker[1] {
+		case 0xc0, 0xc1, 0xc2:
+			return true
+		case 0xc3, 0xc5, 0xc6, 0xc7, 0xc9, 0xca, 0xcb, 0xcd, 0xce, 0xcf, 0xda, 0xd9:
+			return false
+		}
+		pos += 2 + int64(binary.BigEndian.Uint16(marker[2:]))
+	}
+	return false
+}
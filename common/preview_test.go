@@ -0,0 +1,93 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// a baseline jpeg as far as isViewableJPEG looks, SOI then SOF0
+var viewableJPEG = []byte{0xff, 0xd8, 0xff, 0xc0, 0x00, 0x0b, 8, 0, 1, 0, 1, 1, 1, 0x11, 0, 0xff, 0xd9}
+
+// a lossless jpeg, bigger than the preview but no viewer decodes it
+var losslessJPEG = append([]byte{0xff, 0xd8, 0xff, 0xc3, 0x00, 0x0b, 8, 0, 1, 0, 1, 1, 1, 0x11, 0}, make([]byte, 64)...)
+
+type tiffEntry struct {
+	tag   uint16
+	value uint32
+}
+
+// appendIFD adds an IFD of LONG entries whose next pointer loops back to itself
+func appendIFD(data []byte, entries []tiffEntry) []byte {
+	offset := uint32(len(data))
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(entries)))
+	for _, entry := range entries {
+		data = binary.LittleEndian.AppendUint16(data, entry.tag)
+		data = binary.LittleEndian.AppendUint16(data, 4)
+		data = binary.LittleEndian.AppendUint32(data, 1)
+		data = binary.LittleEndian.AppendUint32(data, entry.value)
+	}
+	return binary.LittleEndian.AppendUint32(data, offset)
+}
+
+// rawWithPreview is a little endian TIFF whose IFD0 points at a lossless jpeg and a chain of sub
+// IFDs, the one at depth points at the viewable preview. The jpegs come last.
+func rawWithPreview(depth int) []byte {
+	ifd0Size, linkSize, leafSize := 2+3*12+4, 2+12+4, 2+2*12+4
+	lossless := uint32(8 + ifd0Size + (depth-1)*linkSize + leafSize)
+	preview := lossless + uint32(len(losslessJPEG))
+
+	data := []byte("II*\x00\x08\x00\x00\x00")
+	data = appendIFD(data, []tiffEntry{
+		{tagJPEGOffset, lossless},
+		{tagJPEGLength, uint32(len(losslessJPEG))},
+		{tagSubIFDs, uint32(8 + ifd0Size)},
+	})
+	for level := 1; level < depth; level++ {
+		data = appendIFD(data, []tiffEntry{{tagSubIFDs, uint32(len(data) + linkSize)}})
+	}
+	data = appendIFD(data, []tiffEntry{{tagJPEGOffset, preview}, {tagJPEGLength, uint32(len(viewableJPEG))}})
+	data = append(data, losslessJPEG...)
+	return append(data, viewableJPEG...)
+}
+
+func TestExtractPreview(t *testing.T) {
+	fs := &FileSystem{}
+	tests := []struct {
+		name  string
+		depth int
+		found bool
+	}{
+		{"sub ifd", 1, true},
+		{"deepest walked", 3, true},
+		{"past the depth limit", 4, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			preview, err := fs.ExtractPreview(writeFile(t, "photo.nef", rawWithPreview(test.depth)), "image/nef")
+			if !test.found {
+				if !errors.Is(err, ErrNoPreview) {
+					t.Fatalf("got %v, want ErrNoPreview", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(preview, viewableJPEG) {
+				t.Fatalf("got % x, want the viewable jpeg", preview)
+			}
+		})
+	}
+}
+
+func TestExtractPreviewTruncated(t *testing.T) {
+	// cut inside the preview, its offset and length now run past the end
+	data := rawWithPreview(1)
+	_, err := (&FileSystem{}).ExtractPreview(writeFile(t, "photo.nef", data[:len(data)-6]), "image/nef")
+	if !errors.Is(err, ErrUnreadable) {
+		t.Fatalf("got %v, want ErrUnreadable", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProbeExtension is how the files with one extension were classified
+type ProbeExtension struct {
+	Ext   string `json:"ext"`
+	Files int    `json:"files"`
+	// images and audio/video photoz would pick up
+	Images int `json:"images"`
+	Media  int `json:"media"`
+	// ignored by name or extension, or empty
+	Skipped      int `json:"skipped"`
+	Unrecognized int `json:"unrecognized"`
+	Unreadable   int `json:"unreadable"`
+	// detected mime type to count, unrecognized types included
+	Mimes map[string]int `json:"mimes"`
+}
+
+// ProbeReport is a census of a tree by extension, most common first
+type ProbeReport struct {
+	Files      int              `json:"files"`
+	Extensions []ProbeExtension `json:"extensions"`
+}
+
+// Probe classifies every file under root by its magic bytes only, nothing is hashed or copied
+func (x *FileSystem) Probe(ctx context.Context, root string) (ProbeReport, error) {
+	byExt := make(map[string]*ProbeExtension)
+	report := ProbeReport{}
+	err := filepath.Walk(root, func(filePath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if fi.IsDir() {
+			if fi.Name() == "Thumbs" || fi.Name() == "resources" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(filePath))
+		entry, found := byExt[ext]
+		if !found {
+			entry = &ProbeExtension{Ext: ext, Mimes: make(map[string]int)}
+			byExt[ext] = entry
+		}
+		entry.Files++
+		report.Files++
+
+		if ignore, _ := x.IgnoreByName(filePath); ignore {
+			entry.Skipped++
+			return nil
+		}
+		if ignore, _ := x.IgnoreByExtension(filePath); ignore || fi.Size() == 0 {
+			entry.Skipped++
+			return nil
+		}
+		isImg, mimeType, err := x.IsImage(filePath)
+		if err != nil {
+			entry.Unreadable++
+			return nil
+		}
+		if mimeType == "" {
+			entry.Mimes["unknown"]++
+		} else {
+			entry.Mimes[mimeType]++
+		}
+		switch {
+		case isImg:
+			entry.Images++
+		case IsMedia(mimeType):
+			entry.Media++
+		default:
+			entry.Unrecognized++
+		}
+		return nil
+	})
+
+	for _, entry := range byExt {
+		report.Extensions = append(report.Extensions, *entry)
+	}
+	sort.Slice(report.Extensions, func(i, j int) bool {
+		a, b := report.Extensions[i], report.Extensions[j]
+		if a.Files != b.Files {
+			return a.Files > b.Files
+		}
+		return a.Ext < b.Ext
+	})
+	return report, err
+}
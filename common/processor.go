@@ -0,0 +1,1211 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Config holds everything a run needs, the CLI fills it in from flags.
+type Config struct {
+	InPath  string
+	OutPath string
+	DBPath  string
+	// memory or bolt
+	Backend string
+	Link    LinkMode
+	// source mime type -> jpeg or png, matching originals are re-encoded instead of copied
+	Convert map[string]string
+	// ask on the terminal which copy to keep when a duplicate is dated differently
+	Interactive bool
+	// mime types to parse EXIF for, nil parses every format that has it, the rest are undated unless a Takeout sidecar has the time
+	ExifFormats map[string]bool
+	// copy even when an identical file is already in the output
+	Overwrite bool
+	// lower case output extensions and map aliases like .jpeg to .jpg
+	NormalizeExt bool
+	// name originals whose extension contradicts their content after what they really are
+	FixExtensions bool
+	// rotate converted originals upright, the output orientation is then 1
+	NormalizeOrientation bool
+	// rename originals within their source directory, Link must be LinkMove
+	RenameInPlace bool
+	// delete duplicate sources, only honored with LinkMove
+	RemoveDuplicates bool
+	// re-hash each copy and compare it to the original
+	Verify bool
+	// skip the free space check
+	Force bool
+	Dates DateRange
+	// skip files smaller or larger than these byte counts, zero is no limit
+	MinSize int64
+	MaxSize int64
+	// log a progress line at this interval
+	Progress time.Duration
+	// stop after this many images, zero is no limit
+	Limit int64
+	// walk the input once up front so progress can show a percentage and ETA
+	CountFirst bool
+	// save the db while scanning so a crash loses at most one interval, zero only saves at the end
+	PersistInterval time.Duration
+	// always hash, even when path, size and mtime match a previous run
+	Paranoid bool
+	// copy audio and video into their own output sub folders
+	IncludeAudio bool
+	IncludeVideo bool
+	// permissions for copied originals, zero keeps the 0644 default
+	FilePerm fs.FileMode
+	// permissions for created output directories, zero keeps the 0755 default
+	DirPerm fs.FileMode
+	// mirror the source directories under the output, the first copy seen decides the location
+	PreserveTree bool
+	// sub directories derived from the md5, can't be combined with PreserveTree
+	Shard Shard
+	// DedupGlobal collapses identical files anywhere, DedupDir only within one source directory
+	// so Duplicates counts copies in the same folder, meant for use with PreserveTree
+	DedupScope DedupScope
+	// discover only records originals in the db, copy places what an earlier discover recorded
+	Pass Pass
+	// databases from earlier archives, their originals count as duplicates and aren't copied
+	KnownDBs []string
+	// md5s to tombstone in the db before scanning, one per line, md5sum output works too
+	Tombstones string
+	// doublestar globs matched against paths relative to InPath (ie. **/cache/**)
+	Exclude []string
+	// file name globs skipped on top of DefaultIgnoreNames
+	IgnoreNames []string
+	// descend into symlinked directories, each directory is visited once
+	FollowSymlinks bool
+	// list every zero byte file in the stats
+	ReportEmpty bool
+	// newline separated file paths to process instead of walking InPath
+	FromList string
+	// write a JSON provenance file next to each original
+	Sidecar bool
+	// hash the decoded pixels of jpeg, png and gif originals to find re-encoded copies
+	PixelHash bool
+	// record a hash of each original's first bytes so truncated copies can be reported
+	PartialDupes bool
+	// decode jpeg, png and gif originals to catch corrupt files
+	ValidateDecode bool
+	// copy images whose EXIF fails to parse into a corrupt sub folder
+	QuarantineCorrupt bool
+	// write the embedded jpeg of RAW originals next to them as name.preview.jpg
+	ExtractPreviews bool
+	// copy IMG_xxxx.AAE edit files next to their photo
+	IncludeAAE bool
+	// copy the MOV half of Live Photos next to their photo
+	LivePhotos bool
+	// bytes per read while copying, zero keeps the 32KB default
+	CopyBuffer int
+	// extra copy attempts on transient errors, zero keeps the default and negative is none
+	Retries int
+	// where the processor, its file system and caches log, nil is the global sloan log
+	Logger Logger
+}
+
+// Processor walks the input, dedups images by hash and copies the originals to the output.
+type Processor struct {
+	config Config
+	fs     IFileSystem
+	db     IFastCache
+	// path -> md5, size and mtime from earlier runs
+	paths    IFastCache
+	counters *Counters
+	// originals placed since the db last persisted
+	journal *Journal
+	// asks which copy to keep with -interactive, nil picks the better dated one
+	choose chooser
+	// md5s recorded in the -known-dbs databases
+	known map[string]bool
+	// the output directory, skipped when the walk runs into it
+	outInfo os.FileInfo
+	// directory -> .photozignore rules in effect for its entries
+	ignoreRules map[string][]ignoreRule
+	// source file count and bytes, walked once and shared by -count-first and the free space check
+	sized       bool
+	sourceFiles int64
+	sourceBytes uint64
+	// images run through the pipeline, checked against -limit
+	images int64
+	// directories the walk is inside, outermost first
+	dirs   []dirSummary
+	logger Logger
+}
+
+// PathIndexFile is where the path keyed fast path index lives next to the db
+func PathIndexFile(dbPath string) string {
+	return dbPath + ".paths"
+}
+
+// OpenCache opens the db for a backend, a missing memory db is reported with os.IsNotExist.
+func OpenCache(backend, dbPath string) (IFastCache, error) {
+	switch backend {
+	case "bolt":
+		return NewBoltCache(dbPath)
+	case "memory", "":
+		return NewPersistentCache(dbPath)
+	}
+	return nil, errors.New("unknown backend " + backend)
+}
+
+func NewProcessor(config Config) (*Processor, error) {
+	fs, err := NewFileSystem(config.InPath)
+	if err != nil {
+		loggerOr(config.Logger).Error().Err(err).Str("photoz", "filesystem").Str("file", config.InPath).Msg("does not exist")
+		return nil, err
+	}
+	if config.FilePerm != 0 {
+		fs.FilePerm = config.FilePerm
+	}
+	if config.DirPerm != 0 {
+		fs.DirPerm = config.DirPerm
+	}
+	if config.CopyBuffer > 0 {
+		fs.CopyBufferSize = config.CopyBuffer
+	}
+	if config.Retries > 0 {
+		fs.Retries = config.Retries
+	} else if config.Retries < 0 {
+		fs.Retries = 0
+	}
+	fs.Logger = config.Logger
+	// copied so DefaultIgnoreNames is never appended to
+	fs.IgnoreNames = append(append([]string(nil), fs.IgnoreNames...), config.IgnoreNames...)
+	return NewProcessorFS(config, fs)
+}
+
+// NewProcessorFS runs on the given file system, config permissions and retries are left to it
+func NewProcessorFS(config Config, fs IFileSystem) (*Processor, error) {
+	if _, err := fs.Stat(config.OutPath); err != nil {
+		return nil, err
+	}
+	db, err := OpenCache(config.Backend, config.DBPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	paths, err := OpenCache(config.Backend, PathIndexFile(config.DBPath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	logger := loggerOr(config.Logger)
+	for _, cache := range []IFastCache{db, paths} {
+		if injectable, ok := cache.(interface{ SetLogger(Logger) }); ok {
+			injectable.SetLogger(logger)
+		}
+	}
+	known, err := loadKnown(config.KnownDBs, logger)
+	if err != nil {
+		return nil, err
+	}
+	if config.Tombstones != "" {
+		if err := seedTombstones(db, fs, config.Tombstones, logger); err != nil {
+			return nil, err
+		}
+	}
+	journal, err := OpenJournal(JournalFile(config.DBPath), db, fs, logger)
+	if err != nil {
+		return nil, err
+	}
+	var choose chooser
+	if config.Interactive {
+		if IsTerminal(os.Stdin) {
+			choose = promptChooser(os.Stdin, os.Stdout, logger)
+		} else {
+			logger.Warn().Str("photoz", "interactive").Msg("stdin is not a terminal, duplicates resolved automatically")
+		}
+	}
+	counters := NewCounters()
+	counters.logger = logger
+	return &Processor{
+		config:   config,
+		logger:   logger,
+		fs:       fs,
+		db:       db,
+		paths:    paths,
+		counters: counters,
+		known:    known,
+		journal:  journal,
+		choose:   choose,
+	}, nil
+}
+
+// parsesExif is false for formats left out of -exif
+func (x *Processor) parsesExif(mime string) bool {
+	return x.config.ExifFormats == nil || x.config.ExifFormats[mime]
+}
+
+type DedupScope string
+
+const (
+	DedupGlobal DedupScope = "global"
+	DedupDir    DedupScope = "dir"
+)
+
+func ParseDedupScope(scope string) (DedupScope, error) {
+	switch DedupScope(scope) {
+	case DedupGlobal, DedupDir:
+		return DedupScope(scope), nil
+	}
+	return "", errors.New("unknown dedup scope " + scope)
+}
+
+// Shard spreads the output over sub directories so none holds the whole archive
+type Shard string
+
+const (
+	ShardNone Shard = ""
+	// outPath/ab/cd/name for an md5 starting abcd, a duplicate always lands in the same shard
+	ShardMD5 Shard = "md5"
+)
+
+func ParseShard(shard string) (Shard, error) {
+	switch Shard(shard) {
+	case ShardNone, ShardMD5:
+		return Shard(shard), nil
+	}
+	return "", errors.New("unknown shard " + shard)
+}
+
+// Pass splits a run in two so the plan can be reviewed before anything is written
+type Pass string
+
+const (
+	PassAll      Pass = ""
+	PassDiscover Pass = "discover"
+	PassCopy     Pass = "copy"
+)
+
+func ParsePass(pass string) (Pass, error) {
+	switch Pass(pass) {
+	case PassAll, PassDiscover, PassCopy:
+		return Pass(pass), nil
+	}
+	return "", errors.New("unknown pass " + pass)
+}
+
+// OpenCacheFile opens an existing db, bolt files are told apart by extension
+func OpenCacheFile(dbPath string) (IFastCache, error) {
+	if filepath.Ext(dbPath) == ".bolt" {
+		return OpenCache("bolt", dbPath)
+	}
+	return OpenCache("memory", dbPath)
+}
+
+// loadKnown collects the md5 keys of databases from earlier archives
+func loadKnown(dbPaths []string, logger Logger) (map[string]bool, error) {
+	known := make(map[string]bool)
+	for _, dbPath := range dbPaths {
+		if _, err := os.Stat(dbPath); err != nil {
+			return nil, err
+		}
+		db, err := OpenCacheFile(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		db.ForEach(func(item ImageFileInfo) {
+			known[item.MD5] = true
+		})
+		if closer, ok := db.(io.Closer); ok {
+			closer.Close()
+		}
+		logger.Info().Str("photoz", "known").Str("file", dbPath).Int("total", len(known)).Msg("known db loaded")
+	}
+	return known, nil
+}
+
+// seedTombstones marks every md5 listed in the file, the first field of each line so md5sum output can be fed in
+func seedTombstones(db IFastCache, fs IFileSystem, listFile string, logger Logger) error {
+	lines, err := readList(fs, listFile)
+	if err != nil {
+		return err
+	}
+	total := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		md5 := strings.ToLower(strings.Fields(line)[0])
+		if _, err := hex.DecodeString(md5); err != nil {
+			return fmt.Errorf("%s: %q is not a hash", listFile, md5)
+		}
+		db.Tombstone(md5)
+		total++
+	}
+	logger.Info().Str("photoz", "tombstone").Str("file", listFile).Int("total", total).Msg("tombstones seeded")
+	return nil
+}
+
+func (x *Processor) DB() IFastCache {
+	return x.db
+}
+
+func (x *Processor) Counters() *Counters {
+	return x.counters
+}
+
+// Run scans the input and persists the db, the stats are returned even when the scan fails part way.
+func (x *Processor) Run(ctx context.Context) (Stats, error) {
+	// a cancel during the preflight walks falls through, the scan then stops at once and the db is saved
+	if err := x.checkFreeSpace(ctx); err != nil && ctx.Err() == nil {
+		x.journal.Close()
+		return x.counters.Snapshot(), err
+	}
+
+	if x.config.CountFirst {
+		if files, _, err := x.sourceSize(ctx); err != nil {
+			if ctx.Err() == nil {
+				x.logger.Warn().Err(err).Str("photoz", "filesystem").Str("in", x.config.InPath).Msg("file count failed, progress has no total")
+			}
+		} else {
+			if x.config.Limit > 0 && x.config.Limit < files {
+				files = x.config.Limit
+			}
+			x.counters.SetTotal(files)
+		}
+	}
+
+	if x.config.Progress > 0 {
+		stop := x.counters.ReportProgress(x.config.Progress)
+		defer stop()
+	}
+
+	// stopped before the final persist below so the two saves never overlap
+	stopPersist := func() {}
+	if x.config.PersistInterval > 0 {
+		stopPersist = every(x.config.PersistInterval, x.persist)
+	}
+
+	var err error
+	switch {
+	case x.config.Pass == PassCopy:
+		err = x.placePending(ctx)
+	case x.config.FromList != "":
+		err = x.scanList(ctx)
+	default:
+		err = x.scanTree(ctx)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		x.logger.Error().Err(err).Str("photoz", "file").Msg("directory traverse failed")
+	}
+	if x.limitReached() {
+		x.logger.Info().Str("photoz", "file").Int64("limit", x.config.Limit).Msg("limit reached, scan stopped early")
+	}
+
+	// save the results
+	stopPersist()
+	if perr := x.db.Persist(); perr != nil {
+		x.logger.Error().Err(perr).Str("photoz", "db").Msg("persisting duplicate photo db")
+		if err == nil {
+			err = perr
+		}
+		// the next run replays it
+		x.journal.Close()
+	} else if jerr := x.journal.Remove(); jerr != nil {
+		x.logger.Warn().Err(jerr).Str("photoz", "journal").Msg("journal cleanup")
+	}
+	if perr := x.paths.Persist(); perr != nil {
+		x.logger.Error().Err(perr).Str("photoz", "db").Msg("persisting path index")
+	}
+	return x.counters.Snapshot(), err
+}
+
+// persist checkpoints the db and path index while the scan runs
+func (x *Processor) persist() {
+	sealed, err := x.journal.Seal()
+	if err != nil {
+		x.logger.Error().Err(err).Str("photoz", "journal").Msg("journal seal")
+	}
+	if err := x.db.Persist(); err != nil {
+		x.logger.Error().Err(err).Str("photoz", "db").Msg("auto persist")
+	} else {
+		x.journal.Release(sealed)
+	}
+	if err := x.paths.Persist(); err != nil {
+		x.logger.Error().Err(err).Str("photoz", "db").Msg("auto persist path index")
+	}
+}
+
+// scan recursively for photos
+func (x *Processor) scanTree(ctx context.Context) error {
+	return x.walkTree(ctx, func(filePath string, info os.FileInfo) error {
+		return x.processFile(ctx, filePath, info)
+	})
+}
+
+// walkTree hands every file under the input that isn't excluded or ignored to visit
+func (x *Processor) walkTree(ctx context.Context, visit func(filePath string, info os.FileInfo) error) error {
+	visited := make(map[fileID]bool)
+	x.ignoreRules = make(map[string][]ignoreRule)
+	// an output nested in the input would re-ingest every copy, SameFile sees through symlinks and relative paths
+	if outInfo, err := x.fs.Stat(x.config.OutPath); err == nil {
+		x.outInfo = outInfo
+	}
+	err := x.walk(ctx, x.config.InPath, x.config.InPath, visited, visit)
+	x.leaveDirs("")
+	return err
+}
+
+// walk scans root reporting paths under alias, a followed link keeps the name it was found by
+func (x *Processor) walk(ctx context.Context, root, alias string, visited map[fileID]bool, visit func(filePath string, info os.FileInfo) error) error {
+	return x.fs.Walk(root, func(walkPath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// stop quietly, what was found so far still gets persisted
+		if ctx.Err() != nil || x.limitReached() {
+			return filepath.SkipAll
+		}
+
+		filePath := walkPath
+		if root != alias {
+			rel, err := filepath.Rel(root, walkPath)
+			if err != nil {
+				return err
+			}
+			filePath = filepath.Join(alias, rel)
+		}
+		x.leaveDirs(filePath)
+
+		if x.excluded(filePath) || x.ignored(filePath) {
+			x.logger.Debug().Str("photoz", "walk").Str("file", filePath).Msg("skip by exclude")
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if x.config.FollowSymlinks && fi.Mode()&os.ModeSymlink != 0 {
+			target, err := x.fs.EvalSymlinks(walkPath)
+			if err != nil {
+				x.logger.Warn().Err(err).Str("photoz", "walk").Str("file", filePath).Msg("broken symlink skipped")
+				return nil
+			}
+			linked, err := x.fs.Stat(target)
+			if err != nil {
+				x.logger.Warn().Err(err).Str("photoz", "walk").Str("file", filePath).Msg("broken symlink skipped")
+				return nil
+			}
+			if linked.IsDir() {
+				return x.walk(ctx, target, filePath, visited, visit)
+			}
+			fi = linked
+		} else if fi.Mode()&os.ModeSymlink != 0 {
+			// not followed, a link to a directory has nothing to read
+			if linked, err := x.fs.Stat(walkPath); err == nil && linked.IsDir() {
+				x.logger.Debug().Str("photoz", "walk").Str("file", filePath).Msg("directory symlink not followed")
+				return nil
+			}
+		}
+
+		if fi.IsDir() {
+			// filter known junk paths
+			if fi.Name() == "Thumbs" || fi.Name() == "resources" {
+				return filepath.SkipDir
+			}
+			if x.outInfo != nil && filePath != x.config.InPath && os.SameFile(fi, x.outInfo) {
+				x.logger.Warn().Str("photoz", "walk").Str("file", filePath).Str("out", x.config.OutPath).Msg("output inside the input, skipped")
+				return filepath.SkipDir
+			}
+			// bind mounts and symlinks to an ancestor lead back to a directory already scanned
+			if id, ok := fileIdentity(fi); ok {
+				if visited[id] {
+					x.logger.Debug().Str("photoz", "walk").Str("file", filePath).Msg("directory already visited")
+					return filepath.SkipDir
+				}
+				visited[id] = true
+			}
+			x.enterDir(walkPath, filePath)
+			x.openDir(filePath)
+			return nil
+		}
+		return visit(filePath, fi)
+	})
+}
+
+// limitReached is true once -limit images went through, the rest of the scan is skipped
+func (x *Processor) limitReached() bool {
+	return x.config.Limit > 0 && x.images >= x.config.Limit
+}
+
+// excluded matches the path relative to InPath against the -exclude globs
+func (x *Processor) excluded(filePath string) bool {
+	if len(x.config.Exclude) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(x.config.InPath, filePath)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range x.config.Exclude {
+		if match, _ := doublestar.Match(pattern, rel); match {
+			return true
+		}
+	}
+	return false
+}
+
+// scanList runs the files named in FromList through the same pipeline as the walk
+func (x *Processor) scanList(ctx context.Context) error {
+	filePaths, err := readList(x.fs, x.config.FromList)
+	if err != nil {
+		return err
+	}
+	for _, filePath := range filePaths {
+		if ctx.Err() != nil || x.limitReached() {
+			return nil
+		}
+		fi, err := x.fs.Stat(filePath)
+		if err != nil {
+			x.logger.Error().Err(err).Str("photoz", "list").Str("file", filePath).Msg("unreadable path")
+			x.counters.ListErrors.Add(1)
+			continue
+		}
+		if fi.IsDir() {
+			x.logger.Warn().Str("photoz", "list").Str("file", filePath).Msg("directory in list skipped")
+			continue
+		}
+		err = x.processFile(ctx, filePath, fi)
+		if err == filepath.SkipAll {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readList(fs IFileSystem, listFile string) ([]string, error) {
+	file, err := fs.Open(listFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	filePaths := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			filePaths = append(filePaths, line)
+		}
+	}
+	return filePaths, scanner.Err()
+}
+
+// make sure the new originals will fit before copying anything, links and moves take no space
+func (x *Processor) checkFreeSpace(ctx context.Context) error {
+	if x.config.Force || x.config.Link == LinkSoft || x.config.Link == LinkHard || x.config.Link == LinkMove || x.config.Pass == PassDiscover {
+		return nil
+	}
+	_, needed, err := x.sourceSize(ctx)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		x.logger.Error().Err(err).Str("photoz", "filesystem").Str("in", x.config.InPath).Msg("source size estimate failed")
+		return err
+	}
+	available, err := x.fs.AvailableBytes(x.config.OutPath)
+	if err != nil {
+		x.logger.Warn().Err(err).Str("photoz", "filesystem").Str("out", x.config.OutPath).Msg("free space check skipped")
+		return nil
+	}
+	if needed > available {
+		x.logger.Error().Int64("needed", int64(needed)).Int64("available", int64(available)).Str("out", x.config.OutPath).Msg("not enough free space")
+		return fmt.Errorf("%s needs up to %d bytes but only %d are free on %s", x.config.InPath, needed, available, x.config.OutPath)
+	}
+	return nil
+}
+
+// sourceSize walks the input or -from-list once, later calls reuse the result. The count is every
+// file the scan will look at, the bytes only those that would be new copies.
+func (x *Processor) sourceSize(ctx context.Context) (int64, uint64, error) {
+	if x.sized {
+		return x.sourceFiles, x.sourceBytes, nil
+	}
+	// md5s already counted, copies of one original only take space once
+	seen := make(map[string]bool)
+	estimate := func(filePath string, info os.FileInfo) error {
+		x.sourceFiles++
+		if x.newCopy(filePath, info, seen) {
+			x.sourceBytes += uint64(info.Size())
+		}
+		return nil
+	}
+	var err error
+	switch {
+	case x.config.Pass == PassCopy:
+		for _, fi := range x.pending() {
+			x.sourceFiles++
+			x.sourceBytes += uint64(fi.Size)
+		}
+	case x.config.FromList != "":
+		var filePaths []string
+		filePaths, err = readList(x.fs, x.config.FromList)
+		for _, filePath := range filePaths {
+			if ctx.Err() != nil {
+				break
+			}
+			if info, err := x.fs.Stat(filePath); err == nil && info.Mode().IsRegular() {
+				estimate(filePath, info)
+			}
+		}
+	default:
+		err = x.walkTree(ctx, estimate)
+	}
+	// the walk stops quietly on a cancel, a partial count is no estimate
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		x.sourceFiles, x.sourceBytes = 0, 0
+		return 0, 0, err
+	}
+	x.sized = true
+	return x.sourceFiles, x.sourceBytes, nil
+}
+
+// newCopy runs a file through the scan's filters without logging or counting anything. A file
+// hashed by an earlier run is also checked against the db, it is not read again to find out.
+func (x *Processor) newCopy(filePath string, info os.FileInfo, seen map[string]bool) bool {
+	size := info.Size()
+	if ignore, _ := x.fs.IgnoreByName(filePath); ignore {
+		return false
+	}
+	if ignore, _ := x.fs.IgnoreByExtension(filePath); ignore {
+		return false
+	}
+	if size == 0 || x.outsideSize(size) {
+		return false
+	}
+	isImg, mimeType, err := x.fs.IsImage(filePath)
+	if err != nil || !isImg && (!IsMedia(mimeType) || x.skipsMedia(mimeType)) {
+		return false
+	}
+	md5, found := x.cachedMD5(filePath, info)
+	if !found {
+		return true
+	}
+	if _, stored := x.db.Get(x.dbKey(filePath, md5), ImageFileInfo{}); stored || seen[md5] || x.known[md5] || x.db.IsTombstoned(md5) {
+		return false
+	}
+	seen[md5] = true
+	return true
+}
+
+// outsideSize is true for files outside -min-size/-max-size
+func (x *Processor) outsideSize(size int64) bool {
+	return size < x.config.MinSize || x.config.MaxSize > 0 && size > x.config.MaxSize
+}
+
+// skipsMedia is true for audio and video left out without -include-audio/-include-video
+func (x *Processor) skipsMedia(mimeType string) bool {
+	kind := strings.SplitN(mimeType, "/", 2)[0]
+	return kind == "audio" && !x.config.IncludeAudio || kind == "video" && !x.config.IncludeVideo
+}
+
+func (x *Processor) processFile(ctx context.Context, filePath string, info os.FileInfo) error {
+	fs, db, counters := x.fs, x.db, x.counters
+
+	counters.Files.Add(1)
+	counters.SetCurrent(filePath)
+	size := info.Size()
+	counters.BytesScanned.Add(size)
+	// ignore by name (ie. "._*")
+	toIgnoreByName, rule := fs.IgnoreByName(filePath)
+	if toIgnoreByName {
+		x.logger.Debug().Str("photoz", "file").Str("file", filePath).Str("rule", rule).Msg("skip by name")
+		return nil
+	}
+
+	// ignore by file extension (ie. ".html")
+	toIgnoreByExt, extension := fs.IgnoreByExtension(filePath)
+	if toIgnoreByExt {
+		x.logger.Debug().Str("photoz", "file").Str("file", filePath).Str("ext", extension).Msg("skip by extension")
+		return nil
+	}
+
+	// truncated or failed backups, worth knowing about rather than calling them not an image
+	if size == 0 {
+		x.logger.Warn().Str("photoz", "file").Str("file", filePath).Msg("empty file")
+		counters.AddEmpty(filePath, x.config.ReportEmpty)
+		return nil
+	}
+
+	// thumbnails and huge scans, the size is free from the walk so no file is opened
+	if x.outsideSize(size) {
+		x.logger.Debug().Str("photoz", "file").Str("file", filePath).Int64("size", size).Msg("skip by size")
+		counters.SizeFiltered.Add(1)
+		return nil
+	}
+
+	isImg, mimeType, err := fs.IsImage(filePath)
+	if err != nil {
+		x.logger.Error().Err(err).Str("photoz", "file").Str("file", filePath).Msg("mime type failed")
+		if errors.Is(err, ErrUnreadable) {
+			counters.AddReadError(filePath)
+		}
+		return nil
+	}
+	outDir := ""
+	if !isImg {
+		if !IsMedia(mimeType) {
+			x.logger.Debug().Str("photoz", "file").Str("file", filePath).Str("type", mimeType).Msg("unrecognized")
+			counters.AddUnrecognized(filePath)
+			return nil
+		}
+		if x.skipsMedia(mimeType) {
+			x.logger.Debug().Str("photoz", "file").Str("file", filePath).Str("type", mimeType).Msg("skip media")
+			counters.MediaSkipped.Add(1)
+			return nil
+		}
+		// audio/* and video/* land in "audio" and "video" under the output
+		outDir = strings.SplitN(mimeType, "/", 2)[0]
+	}
+
+	if x.limitReached() {
+		return filepath.SkipAll
+	}
+	x.images++
+
+	x.logger.Debug().Str("photoz", "file").Str("file", filePath).Str("type", mimeType).Msg("processing")
+	// get image md5
+	md5, err := x.hash(ctx, filePath, info)
+	if ctx.Err() != nil {
+		return filepath.SkipAll
+	}
+	if err != nil {
+		x.logger.Error().Err(err).Str("photoz", "file").Str("file", filePath).Msg("md5 failure")
+		if errors.Is(err, ErrUnreadable) {
+			counters.AddReadError(filePath)
+		}
+		return nil
+	}
+	// deliberately pruned earlier, a restored backup doesn't bring it back
+	if db.IsTombstoned(md5) {
+		x.logger.Debug().Str("photoz", "file").Str("file", filePath).Msg("tombstoned")
+		counters.Tombstoned.Add(1)
+		return nil
+	}
+
+	key := x.dbKey(filePath, md5)
+	// the cheap check, the original isn't read for EXIF only to turn out a duplicate
+	if obj, found := db.Get(key, ImageFileInfo{}); found {
+		return x.duplicate(key, obj.(ImageFileInfo), filePath)
+	}
+
+	// already archived on another drive, nothing to copy
+	if x.known[md5] {
+		x.logger.Debug().Str("photoz", "file").Str("file", filePath).Msg("in a known db")
+		counters.Duplicates.Add(1)
+		counters.KnownDuplicates.Add(1)
+		return nil
+	}
+
+	fi := NewImageFileInfo(filePath, mimeType, md5)
+	fi.Size = size
+	if ext, mismatch := ExtensionMismatch(filePath, mimeType); mismatch {
+		x.logger.Warn().Str("photoz", "file").Str("file", filePath).Str("type", mimeType).Str("ext", ext).Msg("extension does not match content")
+		fi.ExtensionMismatch = true
+	}
+	fi.OutDir = outDir
+	if x.config.PreserveTree {
+		relDir, err := filepath.Rel(x.config.InPath, filepath.Dir(filePath))
+		if err != nil {
+			x.logger.Error().Err(err).Str("photoz", "file").Str("file", filePath).Msg("relative path failed")
+			return nil
+		}
+		// listed files outside the input root stay at the top level
+		if relDir == ".." || strings.HasPrefix(relDir, ".."+string(filepath.Separator)) {
+			x.logger.Warn().Str("photoz", "file").Str("file", filePath).Msg("outside input root, tree not preserved")
+			relDir = ""
+		}
+		fi.OutDir = filepath.Join(outDir, relDir)
+		if fi.OutDir == "." {
+			fi.OutDir = ""
+		}
+	}
+	if x.config.Shard == ShardMD5 {
+		fi.OutDir = filepath.Join(fi.OutDir, md5[:2], md5[2:4])
+	}
+
+	if err := x.readDate(&fi, isImg); errors.Is(err, ErrExifCorrupt) {
+		counters.ExifCorrupt.Add(1)
+	}
+
+	if fi.IsJPEG() || fi.IsHEIC() {
+		if partner, found := fs.FindLivePhotoPartner(filePath); found {
+			fi.LivePhotoPartner = partner
+		}
+	}
+
+	// jpeg, png and gif headers are cheap, other formats got theirs from the exif read for the date
+	if isImg && CanDecode(fi.MimeType) {
+		width, height, err := fs.ImageDimensions(filePath, fi.MimeType)
+		if err != nil {
+			x.logger.Debug().Err(err).Str("photoz", "dimensions").Str("file", filePath).Msg("no dimensions")
+		} else {
+			fi.Width, fi.Height = width, height
+		}
+	}
+
+	if x.config.PixelHash && CanDecode(fi.MimeType) {
+		pixelHash, err := fs.PixelHash(filePath, fi.MimeType)
+		if err != nil {
+			x.logger.Warn().Err(err).Str("photoz", "pixelhash").Str("file", filePath).Msg("pixel hash failed")
+		}
+		fi.PixelHash = pixelHash
+	}
+
+	// a truncated copy starts with the same bytes as the full file, smaller files can't be told apart
+	if x.config.PartialDupes && size > HeadHashBytes {
+		headHash, err := fs.PrefixMD5(ctx, filePath, HeadHashBytes)
+		if err != nil {
+			x.logger.Warn().Err(err).Str("photoz", "partial").Str("file", filePath).Msg("head hash failed")
+		}
+		fi.HeadHash = headHash
+	}
+
+	// magic bytes can't tell a truncated jpeg from a good one, a full decode can
+	if x.config.ValidateDecode && CanDecode(fi.MimeType) {
+		if err := fs.DecodeImage(filePath); err != nil {
+			x.logger.Warn().Err(err).Str("photoz", "decode").Str("file", filePath).Msg("image does not decode")
+			counters.DecodeFailed.Add(1)
+		} else {
+			fi.DecodeOK = true
+		}
+	}
+
+	// possibly damaged photos go aside for a manual look
+	if x.config.QuarantineCorrupt && fi.ExifError != "" {
+		fi.OutDir = filepath.Join("corrupt", fi.OutDir)
+	}
+
+	// outside the requested date range, not recorded so a later run can pick it up
+	if !x.config.Dates.Contains(fi) {
+		x.logger.Debug().Str("photoz", "file").Str("file", filePath).Str("date", fi.OriginalDateTime).Msg("skip by date")
+		counters.DateFiltered.Add(1)
+		return nil
+	}
+
+	// set the output filename
+	fi.ConvertedTo = x.config.Convert[fi.MimeType]
+	x.setFileName(&fi)
+	// only the plan is recorded, -pass copy places it later
+	fi.Pending = x.config.Pass == PassDiscover
+
+	// claiming the key decides original or duplicate in one step, the Get above was only a shortcut
+	stored, isNew := db.SetIfAbsent(key, fi)
+	if !isNew {
+		return x.duplicate(key, stored, filePath)
+	}
+	x.logger.Debug().Str("photoz", "file").Str("file", filePath).Msg("original")
+	counters.Originals.Add(1)
+
+	if fi.Pending {
+		return nil
+	}
+	return x.place(ctx, key, fi)
+}
+
+// duplicate records filePath against the original already stored under key
+func (x *Processor) duplicate(key string, fi ImageFileInfo, filePath string) error {
+	// the same file seen again on a later run is not a duplicate of itself, nor counted twice
+	if fi.FilePath == filePath || slices.Contains(fi.DuplicatePaths, filePath) {
+		return nil
+	}
+	if x.config.RemoveDuplicates && x.config.Link == LinkMove {
+		if err := x.fs.DeleteFile(filePath); err != nil {
+			// still recorded as a duplicate, it is just not gone
+			x.logger.Error().Err(err).Str("photoz", "file").Str("file", filePath).Str("original", fi.FilePath).Msg("duplicate remove failed")
+			x.counters.RemoveErrors.Add(1)
+		} else {
+			x.logger.Debug().Str("photoz", "file").Str("file", filePath).Str("original", fi.FilePath).Msg("duplicate removed")
+		}
+	}
+	// a better dated copy can take over, the old original is then the duplicate
+	fi, duplicatePath := x.upgrade(fi, filePath)
+	fi.Duplicates++
+	fi.DuplicatePaths = append(fi.DuplicatePaths, duplicatePath)
+	x.db.Set(key, fi, -1)
+	if duplicatePath != filePath {
+		x.journal.Record(key, fi)
+	}
+	x.counters.Duplicates.Add(1)
+	return nil
+}
+
+// place copies, links or converts an original into the output along with its companions
+func (x *Processor) place(ctx context.Context, key string, fi ImageFileInfo) error {
+	fs, db, counters := x.fs, x.db, x.counters
+	filePath, size, md5 := fi.FilePath, fi.Size, fi.MD5
+	target, convert := fi.ConvertedTo, fi.ConvertedTo != ""
+	pending := fi.Pending
+	var err error
+
+	outFile := filepath.Join(x.config.OutPath, fi.OutputPath())
+	if x.config.RenameInPlace {
+		outFile = filepath.Join(filepath.Dir(filePath), fi.FileName)
+	} else if fi.OutDir != "" {
+		if err := fs.MkdirAll(filepath.Dir(outFile)); err != nil {
+			x.logger.Error().Err(err).Str("photoz", "copy").Str("dir", filepath.Dir(outFile)).Msg("create output directory failed")
+			counters.CopyErrors.Add(1)
+			// never copied, the next run has to try it again
+			x.forget(key, pending)
+			return nil
+		}
+	}
+
+	// sync object changes back to the db
+	db.Set(key, fi, -1)
+
+	// copy to output directory
+	x.logger.Debug().Msg("cp " + filePath + " , " + outFile)
+	switch {
+	case convert:
+		orientation := 0
+		if x.config.NormalizeOrientation {
+			orientation = fi.Orientation
+		}
+		err = fs.ConvertFile(filePath, outFile, target, orientation)
+		if err == nil && orientation > 1 {
+			fi.Orientation = 1
+			db.Set(key, fi, -1)
+		}
+	case !x.config.Overwrite && fs.HasCopy(ctx, outFile, size, md5):
+		// an earlier run already wrote it, re-copying a mostly complete archive is wasted I/O
+		x.logger.Debug().Str("photoz", "copy").Str("outFile", outFile).Msg("already present")
+		counters.AlreadyPresent.Add(1)
+	default:
+		if x.config.Overwrite && (x.config.Link == LinkHard || x.config.Link == LinkSoft) {
+			// links won't replace an existing file
+			fs.DeleteFile(outFile)
+		}
+		err = fs.LinkFile(ctx, filePath, outFile, x.config.Link)
+	}
+	if ctx.Err() != nil {
+		// the copy was interrupted, forget this one so the next run retries it
+		x.forget(key, pending)
+		return filepath.SkipAll
+	}
+	if err != nil {
+		x.logger.Error().Err(err).Str("photoz", "copy").Str("inFile", filePath).Str("outFile", outFile).Msg("original file copy failed")
+		counters.CopyErrors.Add(1)
+		// never copied, the next run has to try it again
+		x.forget(key, pending)
+		if IsDiskFull(err) {
+			// every remaining copy would fail too
+			return err
+		}
+		return nil
+	}
+
+	// the original now lives under its new name, a later run has to recognize it there
+	fi.Pending = false
+	if x.config.RenameInPlace {
+		fi.FilePath = outFile
+	}
+	if x.config.RenameInPlace || pending {
+		db.Set(key, fi, -1)
+	}
+
+	// a converted copy never hashes like its source
+	if x.config.Verify && !convert {
+		// re-read the copy, doubles the read I/O
+		outMD5, err := fs.CalculateMD5(ctx, outFile)
+		if err != nil || outMD5 != md5 {
+			x.logger.Error().Err(err).Str("photoz", "verify").Str("inFile", filePath).Str("outFile", outFile).Str("md5", md5).Str("outMD5", outMD5).Msg("copy verification failed")
+			counters.VerifyFailed.Add(1)
+			x.forget(key, pending)
+			return nil
+		}
+		fi.Verified = true
+		db.Set(key, fi, -1)
+	}
+
+	// a kill before the next persist would otherwise forget this copy
+	if err := x.journal.Record(key, fi); err != nil {
+		x.logger.Error().Err(err).Str("photoz", "journal").Str("file", filePath).Msg("journal write failed")
+	}
+
+	if x.config.Sidecar {
+		fs.WriteSidecar(outFile, fi)
+	}
+
+	if x.config.LivePhotos && fi.LivePhotoPartner != "" {
+		// same stem as the photo so the pair still plays as a Live Photo
+		outMOV := strings.TrimSuffix(outFile, filepath.Ext(outFile)) + filepath.Ext(fi.LivePhotoPartner)
+		if err := fs.CopyFile(ctx, fi.LivePhotoPartner, outMOV); err != nil {
+			x.logger.Error().Err(err).Str("photoz", "copy").Str("inFile", fi.LivePhotoPartner).Str("outFile", outMOV).Msg("live photo copy failed")
+		}
+	}
+
+	if x.config.IncludeAAE {
+		if aaeFile, found := fs.FindAAE(filePath); found {
+			// named after the output so the pair still sorts together
+			outAAE := strings.TrimSuffix(outFile, filepath.Ext(outFile)) + filepath.Ext(aaeFile)
+			if err := fs.CopyFile(ctx, aaeFile, outAAE); err != nil {
+				x.logger.Error().Err(err).Str("photoz", "copy").Str("inFile", aaeFile).Str("outFile", outAAE).Msg("aae copy failed")
+			}
+		}
+	}
+
+	// a viewable jpeg without decoding the RAW, a converted original is viewable already
+	if x.config.ExtractPreviews && IsRAW(fi.MimeType) && !convert {
+		preview, err := fs.ExtractPreview(filePath, fi.MimeType)
+		if err != nil {
+			x.logger.Warn().Err(err).Str("photoz", "preview").Str("file", filePath).Msg("no preview extracted")
+		} else {
+			fs.WritePreview(PreviewFile(outFile), preview)
+		}
+	}
+	return nil
+}
+
+// pending collects what -pass discover recorded, ForEach can't write to a bolt db while it runs
+func (x *Processor) pending() []ImageFileInfo {
+	out := make([]ImageFileInfo, 0)
+	x.db.ForEach(func(fi ImageFileInfo) {
+		if fi.Pending {
+			out = append(out, fi)
+		}
+	})
+	return out
+}
+
+// placePending is -pass copy, the originals recorded by -pass discover are placed without walking the input
+func (x *Processor) placePending(ctx context.Context) error {
+	for _, fi := range x.pending() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if x.limitReached() {
+			return nil
+		}
+		x.images++
+		x.counters.Files.Add(1)
+		x.counters.SetCurrent(fi.FilePath)
+		x.counters.BytesScanned.Add(fi.Size)
+		if _, err := x.fs.Stat(fi.FilePath); err != nil {
+			x.logger.Error().Err(err).Str("photoz", "copy").Str("file", fi.FilePath).Msg("planned original is gone")
+			x.counters.AddReadError(fi.FilePath)
+			continue
+		}
+		x.counters.Originals.Add(1)
+		if err := x.place(ctx, x.dbKey(fi.FilePath, fi.MD5), fi); err != nil {
+			if err == filepath.SkipAll {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// forget drops a failed original so the next run retries it, a planned one goes back to pending
+func (x *Processor) forget(key string, pending bool) {
+	if !pending {
+		x.db.Remove(key)
+		return
+	}
+	if obj, found := x.db.Get(key, ImageFileInfo{}); found {
+		fi := obj.(ImageFileInfo)
+		fi.Pending = true
+		x.db.Set(key, fi, -1)
+	}
+}
+
+// setFileName names the output, -normalize-ext and -convert adjust the extension
+func (x *Processor) setFileName(fi *ImageFileInfo) {
+	fi.SetFileName()
+	if x.config.FixExtensions {
+		fi.FixExtension()
+	}
+	if x.config.NormalizeExt {
+		fi.NormalizeExtension()
+	}
+	// transcoded originals keep the source md5 in their name so dedup stays consistent
+	if fi.ConvertedTo != "" {
+		fi.FileName = strings.TrimSuffix(fi.FileName, filepath.Ext(fi.FileName)) + ConvertExtension(fi.ConvertedTo)
+	}
+}
+
+// readDate fills in the EXIF date, or the Takeout sidecar date for an image without one
+func (x *Processor) readDate(fi *ImageFileInfo, isImg bool) error {
+	var err error
+	if (fi.IsJPEG() || fi.IsTIFF() || fi.IsHEIC() || fi.IsWebP() || fi.IsAVIF()) && x.parsesExif(fi.MimeType) {
+		// parse the EXIF data
+		fi.SetLogger(x.logger)
+		err = fi.GetJpegCreatedAt()
+		fi.HasExif = err == nil
+		if errors.Is(err, ErrExifCorrupt) {
+			fi.ExifError = err.Error()
+		}
+	}
+
+	// Takeout exports lose their EXIF, the JSON sidecar still has the capture time
+	if fi.OriginalDateTime == "" && isImg {
+		if taken, found := x.fs.TakeoutTime(fi.FilePath); found {
+			x.logger.Debug().Str("photoz", "takeout").Str("file", fi.FilePath).Msg("dated by takeout sidecar")
+			fi.OriginalDateTime = fmt.Sprintf("%d", taken.Unix())
+		}
+	}
+	return err
+}
+
+// dbKey is the md5, or with DedupDir the source directory plus md5 so only files side by side collapse
+func (x *Processor) dbKey(filePath, md5 string) string {
+	if x.config.DedupScope == DedupDir {
+		return filepath.Join(filepath.Dir(filePath), md5)
+	}
+	return md5
+}
+
+// hash reuses the md5 from an earlier run when the path, size and mtime are unchanged
+func (x *Processor) hash(ctx context.Context, filePath string, info os.FileInfo) (string, error) {
+	if md5, found := x.cachedMD5(filePath, info); found {
+		x.logger.Debug().Str("photoz", "file").Str("file", filePath).Msg("unchanged, md5 reused")
+		return md5, nil
+	}
+
+	md5, err := x.fs.CalculateMD5(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+	x.paths.Set(filePath, ImageFileInfo{FilePath: filePath, MD5: md5, Size: info.Size(), ModTime: info.ModTime().UnixNano()}, -1)
+	return md5, nil
+}
+
+// cachedMD5 is the md5 the path index has for an unchanged file, -paranoid always hashes
+func (x *Processor) cachedMD5(filePath string, info os.FileInfo) (string, bool) {
+	if x.config.Paranoid {
+		return "", false
+	}
+	obj, found := x.paths.Get(filePath, ImageFileInfo{})
+	if !found {
+		return "", false
+	}
+	seen := obj.(ImageFileInfo)
+	if seen.Size != info.Size() || seen.ModTime != info.ModTime().UnixNano() || seen.MD5 == "" {
+		return "", false
+	}
+	return seen.MD5, true
+}
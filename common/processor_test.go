@@ -0,0 +1,368 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// cancelAfter cancels the scan once it has sniffed n files
+type cancelAfter struct {
+	*FileSystem
+	n      int
+	cancel func()
+}
+
+func (x *cancelAfter) IsImage(filePath string) (bool, string, error) {
+	if x.n--; x.n == 0 {
+		x.cancel()
+	}
+	return x.FileSystem.IsImage(filePath)
+}
+
+func TestRunCancelled(t *testing.T) {
+	inPath := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	for i := 0; i < 200; i++ {
+		dir := filepath.Join(inPath, fmt.Sprintf("dir%02d", i%10))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%03d.png", i)), append(png, byte(i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		config Config
+		// files the scan may still look at, a cancel in a preflight walk leaves none
+		most int64
+	}{
+		{"free space walk", Config{}, 0},
+		{"count walk", Config{Force: true, CountFirst: true}, 0},
+		{"scan", Config{Force: true}, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			fs, err := NewFileSystem(inPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dbPath := filepath.Join(t.TempDir(), "photoz.db")
+			config := test.config
+			config.InPath, config.OutPath, config.DBPath = inPath, t.TempDir(), dbPath
+			processor, err := NewProcessorFS(config, &cancelAfter{fs, 10, cancel})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan struct{})
+			var stats Stats
+			go func() {
+				stats, err = processor.Run(ctx)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run did not return after cancel")
+			}
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("got %v, want context.Canceled", err)
+			}
+			if stats.Files > test.most {
+				t.Fatalf("scanned %d files after cancel, want at most %d", stats.Files, test.most)
+			}
+			if _, err := os.Stat(dbPath); err != nil {
+				t.Fatalf("db not persisted: %v", err)
+			}
+		})
+	}
+}
+
+func TestRerunDuplicateCountedOnce(t *testing.T) {
+	inPath, outPath := t.TempDir(), t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	if err := os.MkdirAll(filepath.Join(inPath, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.png", filepath.Join("sub", "b.png")} {
+		if err := os.WriteFile(filepath.Join(inPath, name), png, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbPath := filepath.Join(t.TempDir(), "photoz.db")
+	for run := 0; run < 3; run++ {
+		processor, err := NewProcessor(Config{InPath: inPath, OutPath: outPath, DBPath: dbPath})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := processor.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := OpenCache("memory", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := db.Keys()
+	if len(keys) != 1 {
+		t.Fatalf("got %d originals, want 1", len(keys))
+	}
+	obj, _ := db.Get(keys[0], ImageFileInfo{})
+	if fi := obj.(ImageFileInfo); fi.Duplicates != 1 || len(fi.DuplicatePaths) != 1 {
+		t.Fatalf("got %d duplicates %v after three runs, want 1", fi.Duplicates, fi.DuplicatePaths)
+	}
+}
+
+func TestDirectorySymlinkNotFollowed(t *testing.T) {
+	inPath, outPath := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(inPath, "a.png"), []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(inPath, "link")); err != nil {
+		t.Skip(err)
+	}
+	processor, err := NewProcessor(Config{InPath: inPath, OutPath: outPath, DBPath: filepath.Join(t.TempDir(), "photoz.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := processor.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Failures() != 0 || stats.Originals != 1 {
+		t.Fatalf("got %d failures and %d originals, want 0 and 1", stats.Failures(), stats.Originals)
+	}
+}
+
+// fullDisk is the real file system on an output volume with little free space
+type fullDisk struct {
+	*FileSystem
+	available uint64
+}
+
+func (x *fullDisk) AvailableBytes(path string) (uint64, error) {
+	return x.available, nil
+}
+
+func TestFreeSpaceCountsNewCopiesOnly(t *testing.T) {
+	inPath, outPath := t.TempDir(), t.TempDir()
+	png := append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), make([]byte, 100)...)
+	files := map[string][]byte{
+		"a.png":     png,
+		"copy.png":  png,
+		"notes.txt": make([]byte, 1000),
+		"clip.avi":  append([]byte("RIFF\x00\x00\x00\x00AVI "), make([]byte, 1000)...),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(inPath, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbPath := filepath.Join(t.TempDir(), "photoz.db")
+	run := func(available uint64) error {
+		fs, err := NewFileSystem(inPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		processor, err := NewProcessorFS(Config{InPath: inPath, OutPath: outPath, DBPath: dbPath}, &fullDisk{fs, available})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = processor.Run(context.Background())
+		return err
+	}
+
+	// the text and the skipped video need no space, both pngs count until a run has hashed them
+	if err := run(2*uint64(len(png)) - 1); err == nil {
+		t.Fatal("ran with less space than the pngs need")
+	}
+	if err := run(2 * uint64(len(png))); err != nil {
+		t.Fatal(err)
+	}
+	// the rerun copies nothing new
+	if err := run(0); err != nil {
+		t.Fatalf("rerun into a full disk: %v", err)
+	}
+}
+
+// failingCopy is the real file system with every copy failing
+type failingCopy struct {
+	*FileSystem
+}
+
+func (x *failingCopy) LinkFile(ctx context.Context, inFile, outFile string, mode LinkMode) error {
+	return errors.New("copy failed")
+}
+
+func TestFailedCopyForgotten(t *testing.T) {
+	inPath, outPath := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(inPath, "a.png"), []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(t.TempDir(), "photoz.db")
+	fs, err := NewFileSystem(inPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor, err := NewProcessorFS(Config{InPath: inPath, OutPath: outPath, DBPath: dbPath}, &failingCopy{fs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.Retries != defaultRetries {
+		t.Fatalf("got %d retries, want the default %d", fs.Retries, defaultRetries)
+	}
+	stats, err := processor.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.CopyErrors != 1 {
+		t.Fatalf("got %d copy errors, want 1", stats.CopyErrors)
+	}
+
+	// the next run has to copy it
+	processor, err = NewProcessor(Config{InPath: inPath, OutPath: outPath, DBPath: dbPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats, err = processor.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Originals != 1 || stats.CopyErrors != 0 {
+		t.Fatalf("got %d originals and %d copy errors on the rerun, want 1 and 0", stats.Originals, stats.CopyErrors)
+	}
+}
+
+// memFS serves a relative input and output from memory, the db and journal at absolute paths stay on disk
+type memFS struct {
+	*FileSystem
+	files  fstest.MapFS
+	copies map[string]string
+}
+
+func (x *memFS) Walk(root string, fn filepath.WalkFunc) error {
+	return fs.WalkDir(x.files, root, func(walkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(walkPath, nil, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fn(walkPath, nil, err)
+		}
+		return fn(walkPath, info, nil)
+	})
+}
+
+func (x *memFS) Stat(name string) (fs.FileInfo, error) {
+	if filepath.IsAbs(name) {
+		return x.FileSystem.Stat(name)
+	}
+	return fs.Stat(x.files, name)
+}
+
+func (x *memFS) Open(name string) (io.ReadCloser, error) {
+	if filepath.IsAbs(name) {
+		return x.FileSystem.Open(name)
+	}
+	return x.files.Open(name)
+}
+
+func (x *memFS) EvalSymlinks(path string) (string, error) {
+	return path, nil
+}
+
+func (x *memFS) IsImage(filePath string) (bool, string, error) {
+	data, err := x.files.ReadFile(filePath)
+	if err != nil {
+		return false, "", unreadable(err)
+	}
+	mime := http.DetectContentType(data)
+	return strings.HasPrefix(mime, "image/"), mime, nil
+}
+
+func (x *memFS) CalculateMD5(ctx context.Context, filePath string) (string, error) {
+	file, err := x.files.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return x.HashReader(file, HashMD5)
+}
+
+func (x *memFS) LinkFile(ctx context.Context, inFile, outFile string, mode LinkMode) error {
+	x.copies[outFile] = inFile
+	return nil
+}
+
+func (x *memFS) MkdirAll(dir string) error {
+	return nil
+}
+
+func (x *memFS) HasCopy(ctx context.Context, outFile string, size int64, md5 string) bool {
+	return false
+}
+
+func (x *memFS) AvailableBytes(path string) (uint64, error) {
+	return 1 << 30, nil
+}
+
+func TestRunInMemory(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	files := fstest.MapFS{
+		"in/a.png":             {Data: png},
+		"in/sub/b.png":         {Data: png},
+		"in/sub/c.png":         {Data: append(png, 1)},
+		"in/skipped/d.png":     {Data: append(png, 2)},
+		"in/notes.txt":         {Data: []byte("not a photo")},
+		"in/" + IgnoreFileName: {Data: []byte("skipped\n")},
+		"out":                  {Mode: fs.ModeDir | 0755},
+		"list.txt":             {Data: []byte("in/sub/c.png\n")},
+	}
+	for _, fromList := range []string{"", "list.txt"} {
+		base, err := NewFileSystem(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		mem := &memFS{FileSystem: base, files: files, copies: make(map[string]string)}
+		config := Config{InPath: "in", OutPath: "out", DBPath: filepath.Join(t.TempDir(), "photoz.db"), FromList: fromList}
+		processor, err := NewProcessorFS(config, mem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats, err := processor.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var copied []string
+		for outFile, inFile := range mem.copies {
+			if !strings.HasPrefix(outFile, "out"+string(filepath.Separator)) {
+				t.Fatalf("copied %s outside the output", outFile)
+			}
+			copied = append(copied, inFile)
+		}
+		slices.Sort(copied)
+		// the walk finds b.png a duplicate and leaves the ignored directory and the text alone
+		want, duplicates := []string{"in/a.png", "in/sub/c.png"}, int64(1)
+		if fromList != "" {
+			want, duplicates = []string{"in/sub/c.png"}, 0
+		}
+		if !slices.Equal(copied, want) || stats.Duplicates != duplicates || stats.Failures() != 0 {
+			t.Fatalf("from list %q: copied %v, %d duplicates and %d failures, want %v and %d", fromList, copied, stats.Duplicates, stats.Failures(), want, duplicates)
+		}
+	}
+}
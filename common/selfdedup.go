@@ -0,0 +1,105 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ExistingGroup is one md5 found more than once in a tree, Keep has the best metadata
+type ExistingGroup struct {
+	MD5    string   `json:"md5"`
+	Keep   string   `json:"keep"`
+	Extras []string `json:"extras"`
+	Size   int64    `json:"size"`
+}
+
+type ExistingReport struct {
+	Images      int             `json:"images"`
+	Groups      []ExistingGroup `json:"groups"`
+	WastedBytes int64           `json:"wastedbytes"`
+	Removed     int             `json:"removed"`
+}
+
+// DeduplicateExisting finds identical images already in root (ie. an old output directory),
+// keeps the copy with EXIF and the earliest date and lists, or with remove deletes, the rest
+func (x *FileSystem) DeduplicateExisting(ctx context.Context, root string, remove bool) (ExistingReport, error) {
+	report := ExistingReport{Groups: []ExistingGroup{}}
+	byMD5 := make(map[string][]ImageFileInfo)
+
+	err := filepath.Walk(root, func(filePath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if fi.IsDir() || !fi.Mode().IsRegular() {
+			return nil
+		}
+		if ignore, _ := x.IgnoreByName(filePath); ignore {
+			return nil
+		}
+		isImg, mime, err := x.IsImage(filePath)
+		if err != nil || !isImg {
+			return nil
+		}
+		md5, err := x.CalculateMD5(ctx, filePath)
+		if err != nil {
+			x.logger().Error().Err(err).Str("photoz", "dedup").Str("file", filePath).Msg("md5 failure")
+			return nil
+		}
+		item := NewImageFileInfo(filePath, mime, md5)
+		item.Size = fi.Size()
+		if item.IsJPEG() || item.IsTIFF() || item.IsHEIC() || item.IsWebP() || item.IsAVIF() {
+			item.SetLogger(x.logger())
+			item.HasExif = item.GetJpegCreatedAt() == nil
+		}
+		report.Images += 1
+		byMD5[md5] = append(byMD5[md5], item)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for md5, items := range byMD5 {
+		if len(items) < 2 {
+			continue
+		}
+		sort.Slice(items, func(i, j int) bool {
+			return betterMetadata(items[i], items[j])
+		})
+		group := ExistingGroup{MD5: md5, Keep: items[0].FilePath, Extras: []string{}, Size: items[0].Size}
+		for _, extra := range items[1:] {
+			group.Extras = append(group.Extras, extra.FilePath)
+			report.WastedBytes += extra.Size
+			if remove {
+				if err := x.DeleteFile(extra.FilePath); err == nil {
+					report.Removed += 1
+				}
+			}
+		}
+		report.Groups = append(report.Groups, group)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		return report.Groups[i].Keep < report.Groups[j].Keep
+	})
+	return report, nil
+}
+
+// betterMetadata prefers EXIF, then the earliest date, then the shortest path
+func betterMetadata(a, b ImageFileInfo) bool {
+	if a.HasExif != b.HasExif {
+		return a.HasExif
+	}
+	if earlier(a, b) || earlier(b, a) {
+		return earlier(a, b)
+	}
+	if len(a.FilePath) != len(b.FilePath) {
+		return len(a.FilePath) < len(b.FilePath)
+	}
+	return a.FilePath < b.FilePath
+}
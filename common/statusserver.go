@@ -0,0 +1,66 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Status is what /status reports while a scan runs
+type Status struct {
+	Files       int64   `json:"files"`
+	Originals   int64   `json:"originals"`
+	Duplicates  int64   `json:"duplicates"`
+	CurrentFile string  `json:"currentfile"`
+	Rate        float64 `json:"rate"`
+}
+
+// StartStatusServer serves /status and /stats on addr (ie. :8080) until stop is called
+func StartStatusServer(addr string, processor *Processor) (stop func(), err error) {
+	// listen up front so a port in use fails before the scan starts
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		counters := processor.Counters()
+		writeJSON(w, processor.logger, Status{
+			Files:       counters.Files.Load(),
+			Originals:   counters.Originals.Load(),
+			Duplicates:  counters.Duplicates.Load(),
+			CurrentFile: counters.Current(),
+			Rate:        counters.Rate(),
+		})
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, processor.logger, struct {
+			Run Stats   `json:"run"`
+			DB  DBStats `json:"db"`
+		}{processor.Counters().Snapshot(), processor.DB().Stats()})
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			processor.logger.Error().Err(err).Str("photoz", "http").Str("addr", addr).Msg("status server failed")
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
+
+func writeJSON(w http.ResponseWriter, logger Logger, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error().Err(err).Str("photoz", "http").Msg("write response")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Google Photos Takeout strips EXIF from many photos but keeps the capture time in a JSON sidecar
+type takeoutMetadata struct {
+	PhotoTakenTime struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"photoTakenTime"`
+}
+
+// a duplicate name gets its counter after the extension in the sidecar, IMG_1(1).jpg -> IMG_1.jpg(1).json
+var takeoutCounter = regexp.MustCompile(`^(.*)(\(\d+\))$`)
+
+// takeoutSidecars are the names Takeout has used for a photo's JSON, most specific first
+func takeoutSidecars(filePath string) []string {
+	dir, name := filepath.Split(filePath)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	names := []string{
+		name + ".supplemental-metadata.json",
+		name + ".json",
+		stem + ".json",
+	}
+	if match := takeoutCounter.FindStringSubmatch(stem); match != nil {
+		names = append(names, match[1]+ext+match[2]+".json")
+	}
+	// edits share the sidecar of the photo they were made from
+	if original, edited := strings.CutSuffix(stem, "-edited"); edited {
+		names = append(names, original+ext+".json")
+	}
+	out := make([]string, 0, len(names))
+	for _, sidecar := range names {
+		out = append(out, filepath.Join(dir, sidecar))
+	}
+	return out
+}
+
+// TakeoutTime reads photoTakenTime from the photo's Takeout sidecar
+func (x *FileSystem) TakeoutTime(filePath string) (time.Time, bool) {
+	for _, sidecar := range takeoutSidecars(filePath) {
+		data, err := os.ReadFile(sidecar)
+		if err != nil {
+			continue
+		}
+		var meta takeoutMetadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			x.logger().Warn().Err(err).Str("photoz", "takeout").Str("file", sidecar).Msg("unreadable sidecar")
+			continue
+		}
+		seconds, err := strconv.ParseInt(meta.PhotoTakenTime.Timestamp, 10, 64)
+		if err != nil || seconds <= 0 {
+			continue
+		}
+		return time.Unix(seconds, 0).UTC(), true
+	}
+	return time.Time{}, false
+}
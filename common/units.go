@@ -0,0 +1,46 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HumanBytes formats a byte count using binary units (ie. 1.5 GB)
+func HumanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// ParseBytes reads sizes like 500KB, 1.5GB or 2048 using the same binary units as HumanBytes
+func ParseBytes(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	if value == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	for i, suffix := range []string{"KB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(value, suffix) {
+			multiplier = int64(1) << (10 * (i + 1))
+			value = strings.TrimSuffix(value, suffix)
+			break
+		}
+	}
+	if multiplier == 1 {
+		value = strings.TrimSuffix(value, "B")
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return int64(n * float64(multiplier)), nil
+}
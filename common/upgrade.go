@@ -0,0 +1,92 @@
+// Copyright © 2025 OSINTAMI. This is not yours.
+package common
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// describe reads the date a duplicate's own path gives it. The bytes match the original so only a
+// Takeout sidecar, or EXIF skipped by an earlier -exif, can tell them apart.
+func (x *Processor) describe(stored ImageFileInfo, filePath string) ImageFileInfo {
+	candidate := stored
+	candidate.FilePath = filePath
+	candidate.HasExif, candidate.ExifError, candidate.OriginalDateTime = false, "", ""
+	x.readDate(&candidate, true)
+	return candidate
+}
+
+// datesDiffer is the meaningful difference worth asking about
+func datesDiffer(stored, candidate ImageFileInfo) bool {
+	return stored.HasExif != candidate.HasExif || stored.OriginalDateTime != candidate.OriginalDateTime
+}
+
+// betterDated prefers an EXIF date over none, then any date over none
+func betterDated(a, b ImageFileInfo) bool {
+	if a.HasExif != b.HasExif {
+		return a.HasExif
+	}
+	_, aDated := a.CreatedAt()
+	_, bDated := b.CreatedAt()
+	return aDated && !bDated
+}
+
+// upgrade swaps in a duplicate as the original when it is better dated, or when chosen with
+// -interactive. It returns the entry to store and the path that is now the duplicate.
+func (x *Processor) upgrade(stored ImageFileInfo, filePath string) (ImageFileInfo, string) {
+	// a consumed source (moved, renamed or about to be removed) has nothing left to switch to
+	if x.config.RenameInPlace || x.config.RemoveDuplicates && x.config.Link == LinkMove {
+		return stored, filePath
+	}
+	if stored.HasExif && stored.OriginalDateTime != "" {
+		return stored, filePath
+	}
+	candidate := x.describe(stored, filePath)
+	if !datesDiffer(stored, candidate) {
+		return stored, filePath
+	}
+	// without a prompt the better dated copy wins so output names carry the best date of any copy
+	if x.choose != nil && !x.choose(stored, candidate) || x.choose == nil && !betterDated(candidate, stored) {
+		return stored, filePath
+	}
+	promoted, err := x.promote(stored, candidate)
+	if err != nil {
+		x.logger.Error().Err(err).Str("photoz", "upgrade").Str("file", filePath).Str("original", stored.FilePath).Msg("original kept")
+		return stored, filePath
+	}
+	return promoted, stored.FilePath
+}
+
+// promote makes candidate the original, the output is renamed to the name its date gives it
+func (x *Processor) promote(stored, candidate ImageFileInfo) (ImageFileInfo, error) {
+	promoted := candidate
+	x.setFileName(&promoted)
+	// a planned original has no output yet
+	if stored.Pending || promoted.FileName == stored.FileName {
+		return promoted, nil
+	}
+
+	oldFile := filepath.Join(x.config.OutPath, stored.OutputPath())
+	newFile := filepath.Join(x.config.OutPath, promoted.OutputPath())
+	if err := x.fs.Rename(oldFile, newFile); err != nil {
+		return stored, err
+	}
+	// the sidecar, Live Photo MOV and AAE share the output stem, the md5 in it keeps them to this photo
+	oldStem := strings.TrimSuffix(filepath.Base(oldFile), filepath.Ext(oldFile))
+	newStem := strings.TrimSuffix(newFile, filepath.Ext(newFile))
+	entries, _ := x.fs.ReadDir(filepath.Dir(oldFile))
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), oldStem+".") {
+			continue
+		}
+		companion := filepath.Join(filepath.Dir(oldFile), entry.Name())
+		if err := x.fs.Rename(companion, newStem+strings.TrimPrefix(entry.Name(), oldStem)); err != nil {
+			x.logger.Warn().Err(err).Str("photoz", "upgrade").Str("file", companion).Msg("companion not renamed")
+		}
+	}
+	if x.config.Sidecar {
+		x.fs.WriteSidecar(newFile, promoted)
+	}
+	x.logger.Info().Str("photoz", "upgrade").Str("from", oldFile).Str("to", newFile).Msg("original replaced by a better dated copy")
+	return promoted, nil
+}
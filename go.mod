@@ -3,9 +3,12 @@ module github.com/osintami/photoz
 go 1.24.0
 
 require (
+	github.com/bmatcuk/doublestar/v4 v4.10.0
 	github.com/dsoprea/go-exif/v3 v3.0.1
 	github.com/osintami/sloan v0.0.0-20250322235302-448785a1fe6b
 	github.com/patrickmn/go-cache v2.1.0+incompatible
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/text v0.29.0
 )
 
 require (
@@ -14,5 +17,6 @@ require (
 	github.com/go-errors/errors v1.4.2 // indirect
 	github.com/golang/geo v0.0.0-20210211234256-740aa86cb551 // indirect
 	golang.org/x/net v0.0.0-20221002022538-bcab6841153b // indirect
+	golang.org/x/sys v0.29.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -2,38 +2,371 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/osintami/photoz/common"
 	"github.com/osintami/sloan/log"
 )
 
+// splitList breaks a comma separated flag into its non empty parts
+func splitList(value string) []string {
+	out := make([]string, 0)
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func logOptions(level, format string) (string, bool, error) {
+	switch level {
+	case "error", "warn", "info", "debug":
+	default:
+		return "", false, errors.New("unknown log level " + level)
+	}
+	switch format {
+	case "json", "console":
+	default:
+		return "", false, errors.New("unknown log format " + format)
+	}
+	return strings.ToUpper(level), format == "console", nil
+}
+
+// envDefaults fills flags left off the command line from PHOTOZ_<NAME> (ie. -from-list is
+// PHOTOZ_FROM_LIST), so a flag beats the environment which beats the built in default
+func envDefaults() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		name := "PHOTOZ_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, found := os.LookupEnv(name); found {
+			if setErr := flag.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("%s: %w", name, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// stringList collects a flag given more than once
+type stringList []string
+
+func (x *stringList) String() string {
+	return strings.Join(*x, ",")
+}
+
+func (x *stringList) Set(value string) error {
+	*x = append(*x, value)
+	return nil
+}
+
 func main() {
 
 	// handle command line arguments
-	var inPath, outPath string
-	var clean, debug, stats bool
+	var inPath, outPath, link, backend, since, until, perm, dirPerm, exifDump, identifyPath, fromList, dbPath, exportJSONL, minSize, maxSize, httpAddr, knownDBs, merge, convert, dedupScope, logLevel, logFormat, hashOnly, copyBuffer, exifFormats, tombstones, pass, diff, shard, histogram string
+	var clean, debug, stats, asJSON, force, verify, includeUndated, paranoid, includeAudio, includeVideo, preserveTree, followSymlinks, reportEmpty, sidecar, pixelHash, validateDecode, quarantineCorrupt, includeAAE, extractPreviews, livePhotos, renameInPlace, removeDuplicates, deduplicateExisting, overwrite, normalizeOrientation, reportDuplicates, flattenDuplicates, audit, countFirst, compact, probe, interactive, normalizeExt, partialDupes, indexOnly, fixExt bool
+	var exclude, ignoreNames stringList
+	var retries, failOnError int
+	var limit int64
+	var progress, persistInterval time.Duration
 
 	flag.StringVar(&inPath, "in", "backups", "starting point")
 	flag.StringVar(&outPath, "out", "originals", "output path")
+	flag.StringVar(&link, "link", "copy", "how originals are placed in the output (copy|hard|soft|move)")
+	flag.StringVar(&minSize, "min-size", "", "skip files smaller than this (ie. 500KB)")
+	flag.StringVar(&maxSize, "max-size", "", "skip files larger than this (ie. 10MB)")
+	flag.StringVar(&exifFormats, "exif", "", "only parse EXIF for these formats (ie. jpeg,heic), others are undated unless a Takeout sidecar has the time, empty is all")
+	flag.StringVar(&convert, "convert", "", "re-encode originals of one format as another (ie. heic:jpeg), comma separated")
+	flag.BoolVar(&fixExt, "fix-ext", false, "give originals whose extension contradicts their content the right one, ie. a png named .jpg")
+	flag.BoolVar(&normalizeExt, "normalize-ext", false, "lower case output extensions and use .jpg for .jpeg and .tiff for .tif")
+	flag.BoolVar(&normalizeOrientation, "normalize-orientation", false, "rotate images upright while -convert re-encodes them")
+	flag.StringVar(&perm, "perm", "0644", "octal permissions for copied originals")
+	flag.StringVar(&dirPerm, "dir-perm", "0755", "octal permissions for directories created in the output")
+	flag.StringVar(&dbPath, "db", "", "database file (default photoz.db in the output path)")
+	flag.StringVar(&backend, "backend", "memory", "db storage (memory|bolt)")
+	flag.StringVar(&identifyPath, "identify", "", "show how a single file would be handled and exit")
+	flag.StringVar(&fromList, "from-list", "", "process the newline separated file paths in this file instead of walking -in")
+	flag.StringVar(&exifDump, "exif-dump", "", "print every EXIF tag in this file and exit")
 	flag.BoolVar(&clean, "clean", false, "clean logs and db, then run normally")
-	flag.BoolVar(&debug, "debug", false, "trace level logging")
+	flag.BoolVar(&debug, "debug", false, "same as -log-level debug")
+	flag.StringVar(&logLevel, "log-level", "error", "photoz.log verbosity (error|warn|info|debug)")
+	flag.StringVar(&logFormat, "log-format", "json", "structured json to photoz.log, or console to also print readable lines (json|console)")
 	flag.BoolVar(&stats, "stats", false, "existing db stats only")
+	flag.StringVar(&diff, "diff", "", "compare the db with an earlier one and report what was added, removed and how each stat moved")
+	flag.BoolVar(&asJSON, "json", false, "print stats as JSON")
+	flag.BoolVar(&reportDuplicates, "report-duplicates", false, "list each original with the paths that duplicated it")
+	flag.BoolVar(&flattenDuplicates, "flatten-duplicates", false, "report the space wasted by duplicates and the worst offenders")
+	flag.StringVar(&exportJSONL, "export-jsonl", "", "write the db as JSON lines to a file, - for stdout")
+	flag.BoolVar(&probe, "probe", false, "count the files under -in by extension and detected type, nothing is hashed or copied")
+	flag.StringVar(&hashOnly, "hash-only", "", "write md5<tab>path for each image under -in to a file, - for stdout, nothing else is done")
+	flag.BoolVar(&compact, "compact", false, "drop db entries whose source is gone and were never copied, then rewrite the db smaller")
+	flag.BoolVar(&audit, "audit", false, "re-hash the output against the db and report missing, extra or changed files")
+	flag.BoolVar(&overwrite, "overwrite", false, "copy originals even when an identical file is already in the output")
+	flag.BoolVar(&force, "force", false, "skip the free space check on the output volume")
+	flag.BoolVar(&verify, "verify", false, "re-hash each copy and compare it to the original")
+	flag.StringVar(&since, "since", "", "only ingest photos taken on or after this date (ie. 2024-01-01)")
+	flag.StringVar(&until, "until", "", "only ingest photos taken on or before this date (ie. 2024-12-31)")
+	flag.BoolVar(&includeUndated, "include-undated", false, "ingest photos without a date when -since or -until is set")
+	flag.BoolVar(&paranoid, "paranoid", false, "always hash files, even when unchanged since the last run")
+	flag.BoolVar(&includeAudio, "include-audio", false, "copy audio files into an audio sub folder")
+	flag.BoolVar(&includeVideo, "include-video", false, "copy video files into a video sub folder")
+	flag.BoolVar(&preserveTree, "preserve-tree", false, "mirror the source directories under the output path")
+	flag.StringVar(&merge, "merge", "", "comma separated dbs to merge into the -db database")
+	flag.StringVar(&histogram, "histogram", "", "year or month, count originals per capture date bucket in the stats")
+	flag.StringVar(&shard, "shard", "", "md5 places each original under out/ab/cd/ by the first four md5 characters")
+	flag.StringVar(&pass, "pass", "", "discover records the plan in the db without copying, copy places what discover recorded")
+	flag.BoolVar(&indexOnly, "index-only", false, "walk, hash and read EXIF into the db without copying anything, -pass discover by another name")
+	flag.StringVar(&dedupScope, "dedup-scope", "global", "collapse duplicates anywhere or only within a source directory (global|dir)")
+	flag.StringVar(&knownDBs, "known-dbs", "", "comma separated dbs from other archives, their photos are treated as duplicates")
+	flag.StringVar(&tombstones, "tombstones", "", "file of md5s deliberately pruned from the source, one per line, they are skipped from now on")
+	flag.Var(&ignoreNames, "ignore-name", "skip files whose name matches this glob (ie. *.tmp), on top of ._*, .DS_Store and Thumbs.db, repeatable")
+	flag.Var(&exclude, "exclude", "skip paths matching this glob relative to -in (ie. **/cache/**), repeatable")
+	flag.BoolVar(&followSymlinks, "follow-symlinks", false, "descend into symlinked directories, loops are skipped")
+	flag.BoolVar(&reportEmpty, "report-empty", false, "list zero byte files in the stats")
+	flag.BoolVar(&sidecar, "sidecar", false, "write the source path, type, md5 and date to a .json next to each original")
+	flag.BoolVar(&partialDupes, "partial-dupes", false, "hash the head of each original and report truncated copies of a larger file")
+	flag.BoolVar(&pixelHash, "pixel-hash", false, "hash decoded jpeg, png and gif pixels and report the same image saved as different files")
+	flag.BoolVar(&validateDecode, "validate-decode", false, "fully decode jpeg, png and gif originals and count the ones that fail")
+	flag.BoolVar(&quarantineCorrupt, "quarantine-corrupt", false, "copy images with unparsable EXIF into a corrupt sub folder")
+	flag.BoolVar(&includeAAE, "include-aae", false, "copy Apple .AAE edit files alongside their photo")
+	flag.BoolVar(&extractPreviews, "extract-previews", false, "write the embedded jpeg of NEF, CR2, DNG and other RAW originals next to them")
+	flag.BoolVar(&renameInPlace, "rename-in-place", false, "rename originals in their source directory instead of copying them")
+	flag.BoolVar(&deduplicateExisting, "deduplicate-existing", false, "find identical images already under -in and list the extras, -remove-duplicates deletes them")
+	flag.BoolVar(&interactive, "interactive", false, "ask which copy to keep when a duplicate is dated differently than the original, needs a terminal")
+	flag.BoolVar(&removeDuplicates, "remove-duplicates", false, "delete duplicate sources, only with -link move, -rename-in-place or -deduplicate-existing")
+	flag.BoolVar(&livePhotos, "live-photos", false, "copy the MOV half of iPhone Live Photos alongside their photo")
+	flag.IntVar(&failOnError, "fail-on-error", 1, "exit non-zero once this many copy, read, verify, list or remove errors occur, 0 only on a failed run")
+	flag.StringVar(&copyBuffer, "copy-buffer", "32KB", "read size while copying originals (ie. 1MB)")
+	flag.IntVar(&retries, "retries", 2, "extra attempts for copies failing with transient I/O errors, 0 is none")
+	flag.DurationVar(&progress, "progress", 0, "print a progress line at this interval (ie. 10s)")
+	flag.Int64Var(&limit, "limit", 0, "stop after this many images, handy for trying options on a sample, 0 is no limit")
+	flag.BoolVar(&countFirst, "count-first", false, "count the input before scanning so progress shows a percentage and ETA, costs an extra walk")
+	flag.StringVar(&httpAddr, "http", "", "serve /status and /stats as JSON on this address while scanning (ie. :8080)")
+	flag.DurationVar(&persistInterval, "persist-interval", 0, "save the db at this interval while scanning (ie. 5m)")
 
 	flag.Parse()
+	if err := envDefaults(); err != nil {
+		fmt.Println("ERROR: ", err)
+		os.Exit(2)
+	}
 
 	// initialize logging interface
-	level := "ERROR"
 	if debug {
-		level = "DEBUG"
+		logLevel = "debug"
+	}
+	level, console, err := logOptions(logLevel, logFormat)
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		os.Exit(2)
+	}
+	log.InitLogger(".", "photoz.log", level, console)
+
+	if identifyPath != "" {
+		if err := identify(identifyPath); err != nil {
+			fmt.Println("ERROR: ", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if exifDump != "" {
+		fi := common.NewImageFileInfo(exifDump, "", "")
+		tags, err := fi.DumpExif()
+		if err != nil {
+			fmt.Println("ERROR: ", err)
+			os.Exit(1)
+		}
+		for _, tag := range tags {
+			fmt.Printf("%s  %s: %v\n", tag.IfdPath, tag.TagName, tag.Value)
+		}
+		return
+	}
+
+	if backend != "memory" && backend != "bolt" {
+		log.Fatal().Str("backend", backend).Msg("invalid argument")
+		return
+	}
+	if dbPath == "" {
+		dbPath = outPath + "/" + "photoz.db"
+		if backend == "bolt" {
+			dbPath = outPath + "/" + "photoz.bolt"
+		}
+	}
+
+	histogramBy, err := common.ParseHistogram(histogram)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "histogram").Msg("invalid argument")
+		return
+	}
+
+	// only print database status, -db alone is enough to point at any database
+	if stats {
+		db, err := openExisting(backend, dbPath)
+		if err != nil {
+			fmt.Println("ERROR: ", err)
+			os.Exit(1)
+		}
+		dbStats(db, inPath, outPath, common.Stats{}, asJSON, reportDuplicates, flattenDuplicates, pixelHash, partialDupes, histogramBy)
+		return
+	}
+
+	// a changelog of the archive since an earlier db
+	if diff != "" {
+		if err := diffDBs(backend, dbPath, diff, asJSON); err != nil {
+			fmt.Println("ERROR: ", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// keep a long lived db lean
+	if compact {
+		if err := compactDB(backend, dbPath, outPath, asJSON); err != nil {
+			fmt.Println("ERROR: ", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// combine per drive databases into one master
+	if merge != "" {
+		if err := mergeDBs(backend, dbPath, splitList(merge)); err != nil {
+			fmt.Println("ERROR: ", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	for _, pattern := range exclude {
+		if !doublestar.ValidatePattern(pattern) {
+			log.Fatal().Str("photoz", "exclude").Str("pattern", pattern).Msg("invalid argument")
+			return
+		}
+	}
+	for _, pattern := range ignoreNames {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			log.Fatal().Err(err).Str("photoz", "ignore-name").Str("pattern", pattern).Msg("invalid argument")
+			return
+		}
+	}
+
+	linkMode, err := common.ParseLinkMode(link)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "link").Msg("invalid argument")
+		return
+	}
+	if renameInPlace {
+		linkMode = common.LinkMove
+	}
+
+	scope, err := common.ParseDedupScope(dedupScope)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "dedup-scope").Msg("invalid argument")
+		return
+	}
+
+	runShard, err := common.ParseShard(shard)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "shard").Msg("invalid argument")
+		return
+	}
+	if runShard != common.ShardNone && (preserveTree || renameInPlace) {
+		log.Fatal().Str("photoz", "shard").Msg("-shard can't be used with -preserve-tree or -rename-in-place")
+		return
+	}
+
+	// the db building half of a split run, -pass copy places it later
+	if indexOnly {
+		if pass != "" && common.Pass(pass) != common.PassDiscover {
+			log.Fatal().Str("photoz", "index-only").Msg("-index-only can't be used with -pass " + pass)
+			return
+		}
+		pass = string(common.PassDiscover)
+	}
+
+	runPass, err := common.ParsePass(pass)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "pass").Msg("invalid argument")
+		return
+	}
+	// discover is for reviewing before anything is touched
+	if runPass == common.PassDiscover && removeDuplicates {
+		log.Fatal().Str("photoz", "pass").Msg("-remove-duplicates can't be used with -pass discover")
+		return
+	}
+
+	dateRange, err := common.ParseDateRange(since, until, includeUndated)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "since/until").Msg("invalid argument")
+		return
+	}
+
+	minBytes, err := common.ParseBytes(minSize)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "min-size").Msg("invalid argument")
+		return
+	}
+	maxBytes, err := common.ParseBytes(maxSize)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "max-size").Msg("invalid argument")
+		return
+	}
+
+	conversions, err := common.ParseConvert(convert)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "convert").Msg("invalid argument")
+		return
+	}
+
+	exifMimes, err := common.ParseExifFormats(exifFormats)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "exif").Msg("invalid argument")
+		return
+	}
+
+	filePerm, err := common.ParsePerm(perm)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "perm").Msg("invalid argument")
+		return
 	}
-	log.InitLogger(".", "photoz.log", level, false)
 
-	dbPath := outPath + "/" + "photoz.db"
+	copyBytes, err := common.ParseBytes(copyBuffer)
+	if err != nil || copyBytes > 1<<30 {
+		log.Fatal().Err(err).Str("photoz", "copy-buffer").Msg("invalid argument")
+		return
+	}
+
+	// the library reads zero as its default, -retries 0 means none
+	if retries == 0 {
+		retries = -1
+	}
+
+	dirMode, err := common.ParsePerm(dirPerm)
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "dir-perm").Msg("invalid argument")
+		return
+	}
 
 	// initialize file system interface
 	fs, err := common.NewFileSystem(inPath)
@@ -41,6 +374,45 @@ func main() {
 		log.Fatal().Err(err).Str("photoz", inPath).Msg("initialize filesystem failed")
 		return
 	}
+	// cloned so DefaultIgnoreNames is never appended to
+	fs.IgnoreNames = append(slices.Clone(common.DefaultIgnoreNames), ignoreNames...)
+
+	// clean up a tree on its own, ie. an old output directory
+	if deduplicateExisting {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		report, err := fs.DeduplicateExisting(ctx, inPath, removeDuplicates)
+		if err != nil {
+			fmt.Println("ERROR: ", err)
+			os.Exit(1)
+		}
+		printExisting(report, asJSON)
+		return
+	}
+
+	// a census of the formats in a tree before committing to a run
+	if probe {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		report, err := fs.Probe(ctx, inPath)
+		if err != nil {
+			fmt.Println("ERROR: ", err)
+			os.Exit(1)
+		}
+		printProbe(report, asJSON)
+		return
+	}
+
+	// a manifest for comparing archives, no output or db needed
+	if hashOnly != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := hashManifest(ctx, fs, inPath, hashOnly); err != nil {
+			fmt.Println("ERROR: ", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// check to see if output directory exists
 	if _, err := os.Stat(outPath); os.IsNotExist(err) {
@@ -48,203 +420,579 @@ func main() {
 		return
 	}
 
-	// only print database status
-	if stats {
-		db, err := common.NewPersistentCache(dbPath)
-		if err != nil && !os.IsNotExist(err) {
+	// stream the database out one entry per line
+	if exportJSONL != "" {
+		db, err := openExisting(backend, dbPath)
+		if err != nil {
 			log.Fatal().Err(err).Str("photoz", dbPath).Msg("initialize db failed")
 			return
 		}
-		dbStats(db, inPath, outPath, 0)
+		if err := exportLines(db, exportJSONL); err != nil {
+			log.Fatal().Err(err).Str("photoz", exportJSONL).Msg("export failed")
+		}
 		return
 	}
 
-	// destroy existing log and picture database
-	if clean {
-		err = fs.DeleteFile("photoz.log")
+	// check the output against the database
+	if audit {
+		db, err := common.OpenCache(backend, dbPath)
 		if err != nil {
-			log.Error().Err(err).Str("photoz", "filesystem").Str("file", "photoz.log").Msg("cleanup failure")
+			log.Fatal().Err(err).Str("photoz", dbPath).Msg("initialize db failed")
+			return
 		}
-		log.InitLogger(".", "photoz.log", level, false)
-		fs.DeleteFile(dbPath)
+		report, err := common.Audit(context.Background(), db, fs, outPath, dbPath, common.PathIndexFile(dbPath), common.JournalFile(dbPath))
 		if err != nil {
-			log.Error().Err(err).Str("photoz", "filesystem").Str("file", dbPath).Msg("cleanup failure")
+			fmt.Println("ERROR: ", err)
 		}
+		printAudit(report, asJSON)
+		if err != nil || !report.OK() {
+			os.Exit(1)
+		}
+		return
 	}
 
-	// initialize duplicates DB
-	db, err := common.NewPersistentCache(dbPath)
-	if err != nil && !os.IsNotExist(err) {
-		log.Error().Err(err).Str("photoz", "db").Msg("initialize db failed")
-		log.Fatal()
+	// destroy existing log and picture database
+	if clean {
+		logErr := fs.DeleteFile("photoz.log")
+		log.InitLogger(".", "photoz.log", level, console)
+		if logErr != nil && !os.IsNotExist(logErr) {
+			log.Error().Err(logErr).Str("photoz", "filesystem").Str("file", "photoz.log").Msg("cleanup failure")
+		}
+		for _, file := range []string{dbPath, common.PathIndexFile(dbPath), common.JournalFile(dbPath)} {
+			if err := fs.DeleteFile(file); err != nil && !os.IsNotExist(err) {
+				log.Error().Err(err).Str("photoz", "filesystem").Str("file", file).Msg("cleanup failure")
+			}
+		}
+	}
+
+	processor, err := common.NewProcessor(common.Config{
+		InPath:               inPath,
+		OutPath:              outPath,
+		DBPath:               dbPath,
+		Backend:              backend,
+		Link:                 linkMode,
+		Verify:               verify,
+		Force:                force,
+		MinSize:              minBytes,
+		MaxSize:              maxBytes,
+		Dates:                dateRange,
+		Progress:             progress,
+		CountFirst:           countFirst,
+		Limit:                limit,
+		ExifFormats:          exifMimes,
+		PersistInterval:      persistInterval,
+		Paranoid:             paranoid,
+		IncludeAudio:         includeAudio,
+		IncludeVideo:         includeVideo,
+		FilePerm:             filePerm,
+		DirPerm:              dirMode,
+		PreserveTree:         preserveTree,
+		Shard:                runShard,
+		DedupScope:           scope,
+		Pass:                 runPass,
+		KnownDBs:             splitList(knownDBs),
+		Tombstones:           tombstones,
+		Exclude:              exclude,
+		IgnoreNames:          ignoreNames,
+		FollowSymlinks:       followSymlinks,
+		ReportEmpty:          reportEmpty,
+		FromList:             fromList,
+		Sidecar:              sidecar,
+		PixelHash:            pixelHash,
+		PartialDupes:         partialDupes,
+		ValidateDecode:       validateDecode,
+		QuarantineCorrupt:    quarantineCorrupt,
+		IncludeAAE:           includeAAE,
+		ExtractPreviews:      extractPreviews,
+		Convert:              conversions,
+		Overwrite:            overwrite,
+		NormalizeOrientation: normalizeOrientation,
+		NormalizeExt:         normalizeExt,
+		FixExtensions:        fixExt,
+		RenameInPlace:        renameInPlace,
+		RemoveDuplicates:     removeDuplicates,
+		Interactive:          interactive,
+		LivePhotos:           livePhotos,
+		CopyBuffer:           int(copyBytes),
+		Retries:              retries,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Str("photoz", "processor").Msg("initialize failed")
 		return
 	}
 
-	fileCount := 0
+	// ctrl-c stops the scan but still saves the db and prints stats
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// scan recursively for photos
-	err = filepath.Walk(inPath, func(filePath string, fi os.FileInfo, err error) error {
+	// poll a long run remotely, the server goes away with the scan
+	stopServer := func() {}
+	if httpAddr != "" {
+		stopServer, err = common.StartStatusServer(httpAddr, processor)
 		if err != nil {
-			return err
+			log.Fatal().Err(err).Str("photoz", "http").Str("addr", httpAddr).Msg("status server failed")
+			return
 		}
+	}
 
-		if fi.IsDir() {
-			// filter known junk paths
-			if fi.Name() == "Thumbs" || fi.Name() == "resources" {
-				return filepath.SkipDir
-			} else {
-				return nil
-			}
+	// the library only logs progress, the terminal gets its own line
+	stopProgress := func() {}
+	if progress > 0 {
+		stopProgress = printProgress(processor.Counters(), progress)
+	}
 
-		} else {
-			fileCount += 1
-			// ignore by name (ie. "._*")
-			toIgnoreByName, _ := fs.IgnoreByName(filePath)
-			if toIgnoreByName {
-				log.Debug().Str("photoz", "file").Str("file", filePath).Msg("skip by name")
-				return nil
-			}
+	runStats, err := processor.Run(ctx)
+	stopProgress()
+	stopServer()
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+	}
+	dbStats(processor.DB(), inPath, outPath, runStats, asJSON, reportDuplicates, flattenDuplicates, pixelHash, partialDupes, histogramBy)
 
-			// ignore by file extension (ie. ".html")
-			toIgnoreByExt, extension := fs.IgnoreByExtension(filePath)
-			if toIgnoreByExt {
-				log.Debug().Str("photoz", "file").Str("file", filePath).Str("ext", extension).Msg("skip by extension")
-				return nil
-			}
+	// let cron and pipelines see a failed or partial run
+	if err != nil || failOnError > 0 && runStats.Failures() >= int64(failOnError) {
+		os.Exit(1)
+	}
+}
 
-			isImg, mimeType, err := fs.IsImage(filePath)
-			if err != nil {
-				log.Error().Str("photoz", "file").Str("file", filePath).Msg("mime type failed")
-			} else if isImg {
-				log.Debug().Str("photoz", "file").Str("file", filePath).Str("type", mimeType).Msg("processing")
-				// get image md5
-				md5, err := fs.CalculateMD5(filePath)
-				if err != nil {
-					log.Error().Err(err).Str("photoz", "file").Str("file", filePath).Msg("md5 failure")
-					return nil
-				}
-				// check db for duplicate
-				fi := common.ImageFileInfo{}
-				obj, found := db.Get(md5, fi)
-				if found {
-					fi := obj.(common.ImageFileInfo)
-					// log.Info().Str("photoz", "file").Str("file", filePath).Msg("duplicate")
-					fi.Duplicates++
-					db.Set(md5, fi, -1)
-					return nil
-				} else {
-					fi := common.NewImageFileInfo(filePath, mimeType, md5)
-
-					log.Debug().Str("photoz", "file").Str("file", filePath).Msg("original")
-
-					outFile := ""
-					if fi.IsJPEG() || fi.IsNEF() || fi.IsHEIC() {
-						// parse the EXIF data
-						err := fi.GetJpegCreatedAt()
-						if err == nil {
-							fi.HasExif = true
-						} else {
-							fi.HasExif = false
-						}
-					}
-					// set the output filename
-					fi.SetFileName()
-					outFile = fi.FileName
-
-					// sync object changes back to the db
-					db.Set(md5, fi, -1)
-
-					// copy to output directory
-					log.Debug().Msg("cp " + filePath + " , " + outPath + "/" + outFile)
-					err := fs.CopyFile(filePath, outPath+"/"+outFile)
-					if err != nil {
-						log.Error().Err(err).Str("photoz", "copy").Str("inFile", filePath).Str("outFile", outPath+"/"+outFile).Msg("original file copy failed")
-					}
-				}
+// openExisting opens a database for reading, bolt would otherwise create an empty one
+func openExisting(backend, dbPath string) (common.IFastCache, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("database %s: %w", dbPath, err)
+	}
+	return common.OpenCache(backend, dbPath)
+}
 
-				return nil
-			}
+func diffDBs(backend, dbPath, oldPath string, asJSON bool) error {
+	db, err := openExisting(backend, dbPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(oldPath); err != nil {
+		return fmt.Errorf("database %s: %w", oldPath, err)
+	}
+	old, err := common.OpenCacheFile(oldPath)
+	if err != nil {
+		return err
+	}
+	printDiff(common.DiffDBs(old, db), asJSON)
+	return nil
+}
 
+func printDiff(diff common.DBDiff, asJSON bool) {
+	if asJSON {
+		out, _ := json.MarshalIndent(diff, "", "    ")
+		fmt.Println(string(out))
+		return
+	}
+	old, cur := diff.Old, diff.New
+	fmt.Printf("    IMAGES:  %d (%+d)\n", cur.Images, cur.Images-old.Images)
+	mimes := cur.SortedMimeTypes()
+	for _, mime := range old.SortedMimeTypes() {
+		if _, found := cur.MimeTypes[mime]; !found {
+			mimes = append(mimes, mime)
 		}
+	}
+	for _, mime := range mimes {
+		fmt.Printf("%22s:  %d (%+d)\n", mime, cur.MimeTypes[mime], cur.MimeTypes[mime]-old.MimeTypes[mime])
+	}
+	fmt.Printf(" ORIGINALS:  %s (%s)\n", common.HumanBytes(cur.OriginalBytes), signedBytes(cur.OriginalBytes-old.OriginalBytes))
+	fmt.Printf("     SAVED:  %s (%s)\n", common.HumanBytes(cur.SavedBytes), signedBytes(cur.SavedBytes-old.SavedBytes))
+	fmt.Printf("DUPLICATES:  %d (%+d)\n", cur.Duplicates, cur.Duplicates-old.Duplicates)
+	fmt.Printf("      EXIF:  %d (%+d)\n", cur.Exif, cur.Exif-old.Exif)
+	fmt.Printf("   CORRUPT:  %d (%+d)\n", cur.ExifCorrupt, cur.ExifCorrupt-old.ExifCorrupt)
+	fmt.Printf("  VERIFIED:  %d (%+d)\n", cur.Verified, cur.Verified-old.Verified)
+	fmt.Println("     ADDED: ", len(diff.Added))
+	for _, item := range diff.Added {
+		fmt.Println("            ", item.FileName)
+	}
+	fmt.Println("   REMOVED: ", len(diff.Removed))
+	for _, item := range diff.Removed {
+		fmt.Println("            ", item.FileName)
+	}
+}
 
+// signedBytes is HumanBytes for a delta
+func signedBytes(n int64) string {
+	if n < 0 {
+		return "-" + common.HumanBytes(-n)
+	}
+	return "+" + common.HumanBytes(n)
+}
+
+func compactDB(backend, dbPath, outPath string, asJSON bool) error {
+	db, err := openExisting(backend, dbPath)
+	if err != nil {
+		return err
+	}
+	paths, err := openExisting(backend, common.PathIndexFile(dbPath))
+	if err != nil {
+		paths = nil
+	}
+	report, err := common.Compact(db, paths, outPath, common.DefaultLogger)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		out, _ := json.MarshalIndent(report, "", "    ")
+		fmt.Println(string(out))
 		return nil
-	})
+	}
+	fmt.Println("   CHECKED: ", report.Checked)
+	fmt.Println("   DROPPED: ", len(report.Dropped))
+	for _, filePath := range report.Dropped {
+		fmt.Println("            ", filePath)
+	}
+	fmt.Println("     PATHS: ", report.PathsDropped)
+	return nil
+}
 
+func mergeDBs(backend, dbPath string, sources []string) error {
+	master, err := common.OpenCache(backend, dbPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, source := range sources {
+		if _, err := os.Stat(source); err != nil {
+			return err
+		}
+		db, err := common.OpenCacheFile(source)
+		if err != nil {
+			return err
+		}
+		added := common.MergeCaches(master, db)
+		if closer, ok := db.(io.Closer); ok {
+			closer.Close()
+		}
+		fmt.Println("    MERGED: ", source, added, "new")
+	}
+	return master.Persist()
+}
+
+func hashManifest(ctx context.Context, fs *common.FileSystem, inPath, fileName string) error {
+	if fileName == "-" {
+		_, err := fs.HashManifest(ctx, inPath, os.Stdout)
+		return err
+	}
+	file, err := os.Create(fileName)
 	if err != nil {
-		log.Error().Err(err).Str("photoz", "file").Msg("directory traverse failed")
+		return err
 	}
+	_, err = fs.HashManifest(ctx, inPath, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
 
-	// save the results
-	err = db.Persist()
+func exportLines(db common.IFastCache, fileName string) error {
+	if fileName == "-" {
+		return db.ToJSONL(os.Stdout)
+	}
+	file, err := os.Create(fileName)
 	if err != nil {
-		log.Error().Err(err).Str("photoz", "db").Msg("persisting duplicate photo db")
+		return err
+	}
+	err = db.ToJSONL(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
-	dbStats(db, inPath, outPath, fileCount)
+	return err
+}
+
+func printExisting(report common.ExistingReport, asJSON bool) {
+	if asJSON {
+		out, _ := json.MarshalIndent(report, "", "    ")
+		fmt.Println(string(out))
+		return
+	}
+	for _, group := range report.Groups {
+		fmt.Println("      KEEP: ", group.Keep)
+		for _, filePath := range group.Extras {
+			fmt.Println("     EXTRA: ", filePath)
+		}
+	}
+	fmt.Println("    IMAGES: ", report.Images)
+	fmt.Println("DUPLICATES: ", len(report.Groups))
+	fmt.Println("    WASTED: ", common.HumanBytes(report.WastedBytes))
+	fmt.Println("   REMOVED: ", report.Removed)
+}
 
+// printProgress prints a progress line every interval until stop is called
+func printProgress(counters *common.Counters, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				p := counters.Progress()
+				if p.Total <= 0 {
+					fmt.Printf("  PROGRESS:  files %d, originals %d, duplicates %d, %.1f files/sec\n", p.Files, p.Originals, p.Duplicates, p.Rate)
+				} else {
+					fmt.Printf("  PROGRESS:  files %d / %d (%.0f%%), originals %d, duplicates %d, %.1f files/sec, eta %s\n", p.Files, p.Total, p.Percent, p.Originals, p.Duplicates, p.Rate, p.ETA)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
 }
 
-func dbStats(db *common.FastCache, basePath, outPath string, fileCount int) {
-	// print stats
-	jsonList := db.List()
-	itemList := make([]common.ImageFileInfo, 0)
-	for _, jsonString := range jsonList {
-		obj := common.ImageFileInfo{}
-		//fmt.Println(jsonString)
-		json.Unmarshal([]byte(jsonString), &obj)
-		itemList = append(itemList, obj)
+// how wide the longest histogram bar is
+const histogramWidth = 50
+
+func printHistogram(dates []common.DateBucket) {
+	most := int64(1)
+	for _, bucket := range dates {
+		most = max(most, bucket.Count)
+	}
+	for _, bucket := range dates {
+		bar := strings.Repeat("#", int((bucket.Count*histogramWidth+most-1)/most))
+		fmt.Printf("%10s:  %-*s %d\n", bucket.Bucket, histogramWidth, bar, bucket.Count)
 	}
+}
 
-	var dups, jpeg, tif, gif, nef, exif, bmp, png, rtf, avi, heic, mjpeg, totalImages int32
-	for _, item := range itemList {
-		dups += item.Duplicates
-		if item.MimeType == "image/jpeg" {
-			jpeg += 1
-		} else if item.MimeType == "image/heic" {
-			heic += 1
-		} else if item.MimeType == "image/nef" {
-			nef += 1
-		} else if item.MimeType == "image/gif" {
-			gif += 1
-		} else if item.MimeType == "image/tiff" {
-			tif += 1
-		} else if item.MimeType == "image/png" {
-			png += 1
-		} else if item.MimeType == "image/bmp" {
-			bmp += 1
-		} else if item.MimeType == "application/rtf" {
-			rtf += 1
-		} else if item.MimeType == "video/x-msvideo" {
-			avi += 1
-		} else if item.MimeType == "video/mjpeg" {
-			mjpeg += 1
+func printProbe(report common.ProbeReport, asJSON bool) {
+	if asJSON {
+		out, _ := json.MarshalIndent(report, "", "    ")
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Printf("%-10s %8s %8s %8s %8s %8s %8s  %s\n", "EXT", "FILES", "IMAGES", "MEDIA", "SKIPPED", "UNKNOWN", "UNREAD", "TYPES")
+	for _, entry := range report.Extensions {
+		ext := entry.Ext
+		if ext == "" {
+			ext = "(none)"
 		}
-		if item.HasExif {
-			exif += 1
+		mimes := make([]string, 0, len(entry.Mimes))
+		for mime, count := range entry.Mimes {
+			mimes = append(mimes, fmt.Sprintf("%s=%d", mime, count))
 		}
+		sort.Strings(mimes)
+		fmt.Printf("%-10s %8d %8d %8d %8d %8d %8d  %s\n", ext, entry.Files, entry.Images, entry.Media, entry.Skipped, entry.Unrecognized, entry.Unreadable, strings.Join(mimes, " "))
+	}
+	fmt.Println("     FILES: ", report.Files)
+}
+
+func printAudit(report common.AuditReport, asJSON bool) {
+	if asJSON {
+		out, _ := json.MarshalIndent(report, "", "    ")
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Println("   CHECKED: ", report.Checked)
+	fmt.Println("   MISSING: ", len(report.Missing))
+	for _, filePath := range report.Missing {
+		fmt.Println("            ", filePath)
+	}
+	fmt.Println("  MISMATCH: ", len(report.Mismatched))
+	for _, filePath := range report.Mismatched {
+		fmt.Println("            ", filePath)
+	}
+	fmt.Println("     EXTRA: ", len(report.Extra))
+	for _, filePath := range report.Extra {
+		fmt.Println("            ", filePath)
+	}
+}
+
+// identify runs the per file checks on one file without touching the db or output
+func identify(filePath string) error {
+	fs, err := common.NewFileSystem(filePath)
+	if err != nil {
+		return err
+	}
+	ignoreByName, name := fs.IgnoreByName(filePath)
+	ignoreByExt, ext := fs.IgnoreByExtension(filePath)
+	isImg, mimeType, err := fs.IsImage(filePath)
+	if err != nil {
+		return err
+	}
+	md5, err := fs.CalculateMD5(context.Background(), filePath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("      FILE: ", filePath)
+	fmt.Println("  SKIPNAME: ", ignoreByName, name)
+	fmt.Println("   SKIPEXT: ", ignoreByExt, ext)
+	fmt.Println("     IMAGE: ", isImg)
+	fmt.Println("      MIME: ", mimeType)
+	fmt.Println("       MD5: ", md5)
+
+	fi := common.NewImageFileInfo(filePath, mimeType, md5)
+	err = fi.GetJpegCreatedAt()
+	if err != nil {
+		fmt.Println("      EXIF: ", err)
+	} else {
+		createdAt, _ := fi.CreatedAt()
+		fmt.Println("      EXIF: ", createdAt.Format(time.DateTime))
+	}
+	fi.SetFileName()
+	fmt.Println("  FILENAME: ", fi.FileName)
+	return nil
+}
+
+// how many of the worst duplicate sets and folders to print
+const topOffenders = 10
+
+func dbStats(db common.IFastCache, basePath, outPath string, runStats common.Stats, asJSON, reportDuplicates, flattenDuplicates, pixelHash, partialDupes bool, histogramBy common.Histogram) {
+	stats := db.Stats()
+	var groups []common.DuplicateGroup
+	if reportDuplicates {
+		groups = common.DuplicateGroups(db)
+	}
+	var pixelGroups []common.PixelGroup
+	if pixelHash {
+		pixelGroups = common.PixelGroups(db)
+	}
+	var partials []common.PartialDuplicate
+	if partialDupes {
+		// only entries hashed with -partial-dupes take part, the prefix check reads the larger file
+		partials = common.PartialDuplicates(context.Background(), db, &common.FileSystem{}, outPath, common.DefaultLogger)
+	}
+	var dates []common.DateBucket
+	if histogramBy != common.HistogramNone {
+		dates = common.DateHistogram(db, histogramBy)
+	}
+	var wasted *common.WastedSpace
+	if flattenDuplicates {
+		flattened := common.FlattenDuplicates(db)
+		wasted = &flattened
 	}
-	totalImages = int32(len(itemList))
+	if asJSON {
+		out, _ := json.MarshalIndent(struct {
+			Input      string                    `json:"input"`
+			Output     string                    `json:"output"`
+			Run        common.Stats              `json:"run"`
+			DB         common.DBStats            `json:"db"`
+			Duplicates []common.DuplicateGroup   `json:"duplicategroups,omitempty"`
+			Wasted     *common.WastedSpace       `json:"wasted,omitempty"`
+			Pixels     []common.PixelGroup       `json:"pixelgroups,omitempty"`
+			Partials   []common.PartialDuplicate `json:"partialduplicates,omitempty"`
+			Histogram  []common.DateBucket       `json:"histogram,omitempty"`
+		}{basePath, outPath, runStats, stats, groups, wasted, pixelGroups, partials, dates}, "", "    ")
+		fmt.Println(string(out))
+		return
+	}
+
 	// TODO:  write to log file properly for reporting
 	fmt.Println("     INPUT: ", basePath)
 	fmt.Println("    OUTPUT: ", outPath)
-	fmt.Println(" PROCESSED: ", fileCount)
-	fmt.Println("DUPLICATES: ", dups)
-	fmt.Println("    IMAGES: ", totalImages)
-	fmt.Println("      JPEG: ", jpeg)
-	fmt.Println("       NEF: ", nef)
-	fmt.Println("      EXIF: ", exif)
-	fmt.Println("      HEIC: ", heic)
-	fmt.Println("       GIF: ", gif)
-	fmt.Println("      TIFF: ", tif)
-	fmt.Println("       BMP: ", bmp)
-	fmt.Println("       PNG: ", png)
-	fmt.Println("       RTF: ", rtf)
-	fmt.Println("       AVI: ", avi)
-	fmt.Println("     MJPEG: ", mjpeg)
-
-	if (jpeg + nef + heic + gif + tif + bmp + png + rtf + avi + mjpeg) != totalImages {
-		fmt.Println("WARNING:  Total Images != (JPEG + NEF + HEIC + GIF + TIFF + BMP + PNG + RTF + AVI + MJPEG)")
-	}
-	if (jpeg + nef) != exif {
-		fmt.Println("WARNING:  JPEG/NEF images with missing EXIF data detected")
+	fmt.Println(" PROCESSED: ", runStats.Files)
+	fmt.Println("   SCANNED: ", common.HumanBytes(runStats.BytesScanned))
+	fmt.Println(" ORIGINALS: ", common.HumanBytes(stats.OriginalBytes))
+	fmt.Println("     SAVED: ", common.HumanBytes(stats.SavedBytes))
+	fmt.Println("DUPLICATES: ", stats.Duplicates)
+	if runStats.KnownDuplicates > 0 {
+		fmt.Println("     KNOWN: ", runStats.KnownDuplicates)
+	}
+	if runStats.Tombstoned > 0 {
+		fmt.Println("TOMBSTONED: ", runStats.Tombstoned)
+	}
+	fmt.Println("    IMAGES: ", stats.Images)
+	for _, mime := range stats.SortedMimeTypes() {
+		fmt.Printf("%22s:  %d\n", mime, stats.MimeTypes[mime])
+	}
+	fmt.Println("      EXIF: ", stats.Exif)
+	fmt.Println("   CORRUPT: ", stats.ExifCorrupt)
+	if stats.ExtensionMismatch > 0 {
+		fmt.Println("MISLABELED: ", stats.ExtensionMismatch)
+	}
+	fmt.Println("  VERIFIED: ", stats.Verified)
+	fmt.Println("  MISMATCH: ", runStats.VerifyFailed)
+	if runStats.DateFiltered > 0 {
+		fmt.Println(" DATE SKIP: ", runStats.DateFiltered)
+	}
+	if runStats.SizeFiltered > 0 {
+		fmt.Println(" SIZE SKIP: ", runStats.SizeFiltered)
+	}
+	fmt.Println("MEDIA SKIP: ", runStats.MediaSkipped)
+	fmt.Println("     EMPTY: ", runStats.Empty)
+	for _, filePath := range runStats.EmptyFiles {
+		fmt.Println("            ", filePath)
+	}
+	if runStats.ListErrors > 0 {
+		fmt.Println("LIST ERROR: ", runStats.ListErrors)
+	}
+	if runStats.DecodeFailed > 0 {
+		fmt.Println("BAD DECODE: ", runStats.DecodeFailed)
+	}
+	if runStats.AlreadyPresent > 0 {
+		fmt.Println("   PRESENT: ", runStats.AlreadyPresent)
+	}
+	fmt.Println("    ERRORS: ", runStats.Errors)
+	if runStats.CopyErrors > 0 {
+		fmt.Println("COPY ERROR: ", runStats.CopyErrors)
+	}
+	if runStats.RemoveErrors > 0 {
+		fmt.Println("  RM ERROR: ", runStats.RemoveErrors)
+	}
+	fmt.Println("READ ERROR: ", runStats.ReadErrors)
+	for _, filePath := range runStats.UnreadableFiles {
+		fmt.Println("            ", filePath)
+	}
+	fmt.Println("   UNKNOWN: ", runStats.Unrecognized)
+	for _, filePath := range runStats.UnrecognizedSamples {
+		fmt.Println("            ", filepath.Ext(filePath), filePath)
+	}
+
+	for _, group := range groups {
+		fmt.Println(" DUPLICATE: ", group.Duplicates, group.FileName)
+		fmt.Println("            ", group.Original)
+		for _, filePath := range group.Paths {
+			fmt.Println("            ", filePath)
+		}
+	}
+
+	// same image, different file
+	for _, group := range pixelGroups {
+		fmt.Println("SAME IMAGE: ", group.PixelHash)
+		for _, filePath := range group.Files {
+			fmt.Println("            ", filePath)
+		}
+	}
+
+	if len(dates) > 0 {
+		printHistogram(dates)
+	}
+
+	// a truncated copy of a complete file
+	for _, pair := range partials {
+		fmt.Println("   PARTIAL: ", pair.Partial, common.HumanBytes(pair.PartialSize))
+		fmt.Println("            ", pair.Complete, common.HumanBytes(pair.CompleteSize))
+	}
+
+	if wasted != nil {
+		fmt.Println("    WASTED: ", common.HumanBytes(wasted.TotalBytes))
+		for i, group := range wasted.Groups {
+			if i == topOffenders {
+				break
+			}
+			fmt.Println("            ", common.HumanBytes(group.WastedBytes), group.Duplicates, group.Original)
+		}
+		for i, folder := range wasted.SortedFolders() {
+			if i == topOffenders {
+				break
+			}
+			fmt.Println("    FOLDER: ", common.HumanBytes(wasted.Folders[folder]), folder)
+		}
+	}
+
+	if stats.MimeTypes[""] > 0 {
+		fmt.Println("WARNING:  Images without a mime type detected")
+	}
+	withExif := stats.MimeTypes["image/jpeg"]
+	for mime, count := range stats.MimeTypes {
+		if common.IsRAW(mime) {
+			withExif += count
+		}
+	}
+	if int64(withExif) != stats.Exif {
+		fmt.Println("WARNING:  JPEG/RAW images with missing EXIF data detected")
 	}
 }